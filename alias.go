@@ -0,0 +1,72 @@
+package fsm
+
+import (
+	"fmt"
+	"sort"
+)
+
+// AddAlias makes alias trigger the same transitions as canonical, from every
+// state. Aliases are resolved before matching, so they never add edges of
+// their own to the transition table or to View, and adding a transition for
+// an alias fails. An alias of an alias refers to the final canonical event.
+func (fm *StateMachine) AddAlias(alias, canonical Event) error {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	if fm.frozen {
+		return ErrFrozen
+	}
+	canonical = fm.canonical(canonical)
+	if alias == canonical {
+		return fmt.Errorf("event: [%v] alias of itself", alias)
+	}
+	for k := range fm.transitions {
+		if k.Event == alias {
+			return fmt.Errorf("event: [%v] already has transitions", alias)
+		}
+	}
+
+	if fm.aliases == nil {
+		fm.aliases = make(map[Event]Event)
+	}
+	for a, c := range fm.aliases {
+		if c == alias {
+			fm.aliases[a] = canonical
+		}
+	}
+	fm.aliases[alias] = canonical
+
+	return nil
+}
+
+// aliasConflict returns an error if event is an alias, which would make a
+// transition registered under it unreachable.
+func (fm *StateMachine) aliasConflict(from State, event Event) error {
+	if canonical, ok := fm.aliases[event]; ok {
+		return fmt.Errorf("state, event: [%v, %v] event is an alias of [%v]", from, event, canonical)
+	}
+
+	return nil
+}
+
+// canonical returns the event that alias stands for, or alias itself.
+func (fm *StateMachine) canonical(alias Event) Event {
+	if event, ok := fm.aliases[alias]; ok {
+		return event
+	}
+
+	return alias
+}
+
+// aliasesOf returns the sorted aliases of event.
+func (fm *StateMachine) aliasesOf(event Event) []Event {
+	aliases := make([]Event, 0)
+	for alias, canonical := range fm.aliases {
+		if canonical == event {
+			aliases = append(aliases, alias)
+		}
+	}
+	sort.Slice(aliases, func(i, j int) bool { return aliases[i] < aliases[j] })
+
+	return aliases
+}
@@ -0,0 +1,73 @@
+package fsm
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAddTransitionRejectsAlias(t *testing.T) {
+	fm := NewStateMachine("A")
+	if err := fm.AddTransitions(&Transition{From: "A", Event: "cancel", To: "B"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fm.AddAlias("abort", "cancel"); err != nil {
+		t.Fatal(err)
+	}
+
+	abort := &Transition{From: "B", Event: "abort", To: "C"}
+	if err := fm.AddTransitions(abort); err == nil {
+		t.Error("AddTransitions accepted a transition for an alias")
+	}
+	if err := fm.AddOrReplaceTransitions(abort); err == nil {
+		t.Error("AddOrReplaceTransitions accepted a transition for an alias")
+	}
+	if err := fm.ReplaceTransition(&Transition{From: "A", Event: "abort", To: "C"}); err == nil {
+		t.Error("ReplaceTransition accepted a transition for an alias")
+	}
+
+	if got := fm.Reachable("A"); len(got) != 2 {
+		t.Errorf("Reachable(A) = %v, want [A B]", got)
+	}
+	if err := fm.Trigger("abort"); err != nil {
+		t.Errorf("Trigger(abort) = %v", err)
+	}
+}
+
+func TestForbidAlias(t *testing.T) {
+	fm := NewStateMachine("A")
+	if err := fm.AddTransitions(&Transition{From: "A", Event: "cancel", To: "B"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fm.AddAlias("abort", "cancel"); err != nil {
+		t.Fatal(err)
+	}
+
+	fm.Forbid("A", "abort", "locked")
+	for _, event := range []Event{"abort", "cancel"} {
+		if err := fm.Trigger(event); !errors.Is(err, ErrForbidden) {
+			t.Errorf("Trigger(%v) = %v, want ErrForbidden", event, err)
+		}
+	}
+
+	fm.Permit("A", "cancel")
+	if err := fm.Trigger("abort"); err != nil {
+		t.Errorf("Trigger(abort) after Permit = %v", err)
+	}
+}
+
+func TestValidatorForAlias(t *testing.T) {
+	fm := NewStateMachine("A")
+	if err := fm.AddTransitions(&Transition{From: "A", Event: "cancel", To: "B"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fm.AddAlias("abort", "cancel"); err != nil {
+		t.Fatal(err)
+	}
+
+	fm.SetEventValidator("abort", func(data any) error { return errors.New("bad") })
+	for _, event := range []Event{"abort", "cancel"} {
+		if err := fm.TriggerWithData(event, 1); !errors.Is(err, ErrInvalidData) {
+			t.Errorf("TriggerWithData(%v) = %v, want ErrInvalidData", event, err)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package fsm
+
+import "fmt"
+
+// Builder assembles a machine transition by transition:
+//
+//	fm, err := NewBuilder(StatePending).
+//		From(StatePending).On(EventPaySuccess).To(StatePaid).Do(onPaid).
+//		From(StatePaid).On(EventShip).To(StateShipped).
+//		Build()
+//
+// Each From starts a new transition; Do is optional. Errors, including
+// duplicate transitions, are reported by Build.
+type Builder struct {
+	initial     State
+	transitions []*Transition
+	err         error
+}
+
+func NewBuilder(initial State) *Builder {
+	return &Builder{initial: initial}
+}
+
+// From starts a new transition leaving state.
+func (b *Builder) From(state State) *Builder {
+	b.transitions = append(b.transitions, &Transition{From: state})
+	return b
+}
+
+// On sets the event of the current transition.
+func (b *Builder) On(event Event) *Builder {
+	if t := b.last("On"); t != nil {
+		t.Event = event
+	}
+	return b
+}
+
+// To sets the destination of the current transition.
+func (b *Builder) To(state State) *Builder {
+	if t := b.last("To"); t != nil {
+		t.To = state
+	}
+	return b
+}
+
+// Do sets the handler of the current transition.
+func (b *Builder) Do(handle TransitionHandler) *Builder {
+	if t := b.last("Do"); t != nil {
+		t.Handle = handle
+	}
+	return b
+}
+
+func (b *Builder) last(method string) *Transition {
+	if len(b.transitions) == 0 {
+		if b.err == nil {
+			b.err = fmt.Errorf("builder: %s called before From", method)
+		}
+		return nil
+	}
+	return b.transitions[len(b.transitions)-1]
+}
+
+// Build returns the machine holding all transitions, or the first error.
+// Each call builds an independent machine with its own copies of the
+// transitions.
+func (b *Builder) Build() (*StateMachine, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	fm := NewStateMachine(b.initial)
+	for _, t := range b.transitions {
+		if t.Event == "" || t.To == "" {
+			return nil, fmt.Errorf("builder: transition from [%v] misses On or To", t.From)
+		}
+		c := t.copy()
+		if err := fm.AddTransitions(&c); err != nil {
+			return nil, err
+		}
+	}
+
+	return fm, nil
+}
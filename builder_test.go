@@ -0,0 +1,29 @@
+package fsm
+
+import "testing"
+
+func TestBuildTwice(t *testing.T) {
+	b := NewBuilder("A").From("A").On("go").To("B")
+	m1, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m2, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ran bool
+	if err := m1.SetHandler("A", "go", func(from State, e Event, to State) error {
+		ran = true
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m2.Trigger("go"); err != nil {
+		t.Fatal(err)
+	}
+	if ran {
+		t.Error("the handler set on the first machine ran on the second")
+	}
+}
@@ -0,0 +1,45 @@
+package fsm
+
+type tuple struct {
+	From  State
+	Event Event
+	To    State
+}
+
+// Equal reports whether fm and other have the same initial state and the
+// same (From, Event, To) transitions. Handlers, guards and the current state
+// are ignored.
+func (fm *StateMachine) Equal(other *StateMachine) bool {
+	if fm.InitialState() != other.InitialState() {
+		return false
+	}
+	added, removed := fm.Diff(other)
+	return len(added) == 0 && len(removed) == 0
+}
+
+// Diff compares the (From, Event, To) transitions of fm and other. added
+// holds the transitions only other has and removed those only fm has, both
+// sorted by (From, Event).
+func (fm *StateMachine) Diff(other *StateMachine) (added, removed []Transition) {
+	// each machine is read under its own lock, never both at once
+	mine, theirs := fm.Transitions(), other.Transitions()
+
+	return subtract(theirs, mine), subtract(mine, theirs)
+}
+
+// subtract returns the transitions of a whose tuple is not in b.
+func subtract(a, b []Transition) []Transition {
+	set := make(map[tuple]bool, len(b))
+	for _, t := range b {
+		set[tuple{t.From, t.Event, t.To}] = true
+	}
+
+	diff := make([]Transition, 0)
+	for _, t := range a {
+		if !set[tuple{t.From, t.Event, t.To}] {
+			diff = append(diff, t)
+		}
+	}
+
+	return diff
+}
@@ -0,0 +1,41 @@
+package fsm
+
+// Definition is an immutable transition table with an initial state, built
+// once and shared by any number of machines created with New. The machines
+// read the shared table without copying it; a machine only gets its own copy
+// when its structure is changed, e.g. by AddTransitions or SetHandler.
+type Definition struct {
+	initial     State
+	transitions map[eKey]*Transition
+	branches    map[eKey][]*Transition
+	wildcards   []eKey
+}
+
+// NewDefinition builds a Definition from transitions, which are checked as
+// by AddTransitions and copied, so changing them afterwards has no effect.
+func NewDefinition(initial State, transitions ...*Transition) (*Definition, error) {
+	fm := NewStateMachine(initial)
+	if err := fm.AddTransitions(transitions...); err != nil {
+		return nil, err
+	}
+
+	d := &Definition{initial: initial}
+	d.transitions, d.branches = copyTable(fm.transitions, fm.branches)
+	d.wildcards = fm.wildcards
+	return d, nil
+}
+
+// InitialState returns the state the machines created by New start in.
+func (d *Definition) InitialState() State {
+	return d.initial
+}
+
+// New returns a machine in the initial state that uses the shared
+// transition table. Per-machine settings such as callbacks and history are
+// independent.
+func (d *Definition) New() *StateMachine {
+	fm := NewStateMachine(d.initial)
+	fm.transitions, fm.branches, fm.shared = d.transitions, d.branches, true
+	fm.wildcards = d.wildcards
+	return fm
+}
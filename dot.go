@@ -0,0 +1,182 @@
+package fsm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ParseDOT builds a machine from the edges of a Graphviz digraph such as the
+// one returned by View:
+//
+//	"A" -> "B" [ label = "evt" ];
+//
+// Header, closing brace, subgraph, rank group, node and comment lines are
+// ignored, as are whitespace and trailing semicolons, so the clusters, ranks
+// and legend of ViewWith do not get in the way. Edges without a label are
+// rejected. The initial state is the node highlighted with a color
+// attribute, as View does for the current state, or else the From of the
+// first edge.
+// Transitions get a no-op handler; use SetHandler to attach the real ones.
+// Several edges with the same source and label, as View draws guarded
+// alternatives, are kept as alternatives of one (from, event) key; having no
+// guards, the first of them is taken.
+func ParseDOT(r io.Reader) (*StateMachine, error) {
+	var (
+		transitions []*Transition
+		initial     State
+		scanner     = bufio.NewScanner(r)
+		lineNo      = 0
+	)
+
+	for scanner.Scan() {
+		lineNo++
+
+		line := strings.TrimSpace(scanner.Text())
+		line = strings.TrimSpace(strings.TrimSuffix(line, ";"))
+		if line == "" || line == "}" || strings.HasPrefix(line, "digraph") ||
+			strings.HasPrefix(line, "subgraph") || strings.HasPrefix(line, "{") ||
+			strings.HasPrefix(line, "//") || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		p := &dotParser{s: line}
+		from, err := p.id()
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+
+		if !p.consume("->") {
+			// a node statement
+			attrs, err := p.attrs()
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			if _, ok := attrs["color"]; ok && initial == "" {
+				initial = State(from)
+			}
+			continue
+		}
+
+		to, err := p.id()
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		attrs, err := p.attrs()
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		label, ok := attrs["label"]
+		if !ok {
+			return nil, fmt.Errorf("line %d: edge without label", lineNo)
+		}
+
+		transitions = append(transitions, &Transition{From: State(from), Event: Event(label), To: State(to), Handle: noopHandler})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(transitions) == 0 {
+		return nil, ErrNoTransitionsDefined
+	}
+
+	if initial == "" {
+		initial = transitions[0].From
+	}
+	fm := NewStateMachine(initial)
+	fm.duplicates = DuplicateAppend
+	if err := fm.AddTransitions(transitions...); err != nil {
+		return nil, err
+	}
+	fm.duplicates = DuplicateError
+
+	return fm, nil
+}
+
+// dotParser scans the statements of a single DOT line.
+type dotParser struct {
+	s string
+}
+
+func (p *dotParser) skipSpace() {
+	p.s = strings.TrimLeft(p.s, " \t")
+}
+
+func (p *dotParser) consume(token string) bool {
+	p.skipSpace()
+	if strings.HasPrefix(p.s, token) {
+		p.s = p.s[len(token):]
+		return true
+	}
+	return false
+}
+
+// id reads a quoted or bare identifier.
+func (p *dotParser) id() (string, error) {
+	p.skipSpace()
+	if strings.HasPrefix(p.s, `"`) {
+		var buf strings.Builder
+		for i := 1; i < len(p.s); i++ {
+			switch c := p.s[i]; c {
+			case '\\':
+				if i+1 < len(p.s) {
+					i++
+					if p.s[i] == 'n' {
+						buf.WriteByte('\n')
+					} else {
+						buf.WriteByte(p.s[i])
+					}
+				}
+			case '"':
+				p.s = p.s[i+1:]
+				return buf.String(), nil
+			default:
+				buf.WriteByte(c)
+			}
+		}
+		return "", fmt.Errorf("unterminated string")
+	}
+
+	end := strings.IndexAny(p.s, " \t[]=,;-")
+	if end < 0 {
+		end = len(p.s)
+	}
+	if end == 0 {
+		return "", fmt.Errorf("expected identifier at %q", p.s)
+	}
+	id := p.s[:end]
+	p.s = p.s[end:]
+
+	return id, nil
+}
+
+// attrs reads an optional [ key = value, ... ] list.
+func (p *dotParser) attrs() (map[string]string, error) {
+	attrs := make(map[string]string)
+	if !p.consume("[") {
+		return attrs, nil
+	}
+
+	for {
+		if p.consume("]") {
+			return attrs, nil
+		}
+		if p.consume(",") || p.consume(";") {
+			continue
+		}
+
+		key, err := p.id()
+		if err != nil {
+			return nil, err
+		}
+		if !p.consume("=") {
+			return nil, fmt.Errorf("expected = after %q", key)
+		}
+		value, err := p.id()
+		if err != nil {
+			return nil, err
+		}
+		attrs[key] = value
+	}
+}
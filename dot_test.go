@@ -0,0 +1,63 @@
+package fsm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseDOTRoundTrip(t *testing.T) {
+	fm := NewStateMachine("A")
+	if err := fm.AddTransitions(
+		&Transition{From: "A", Event: "go", To: "B"},
+		&Transition{From: "B", Event: "go on", To: `C "quoted"`},
+		&Transition{From: "B", Event: "back", To: "A"},
+		&Transition{From: AnyState, Event: "reset", To: "A"},
+	); err != nil {
+		t.Fatal(err)
+	}
+	if err := fm.SetParent("B", "Group"); err != nil {
+		t.Fatal(err)
+	}
+	fm.SetStateColor(`C "quoted"`, "yellow")
+
+	for _, opts := range []ViewOptions{
+		{},
+		{RankByDepth: true},
+		{Legend: true},
+		{RankByDepth: true, Legend: true, CurrentFill: "green"},
+	} {
+		graphViz, _, _ := fm.ViewWith(opts)
+		parsed, err := ParseDOT(strings.NewReader(graphViz))
+		if err != nil {
+			t.Errorf("%+v: %v", opts, err)
+			continue
+		}
+		if !fm.Equal(parsed) {
+			added, removed := fm.Diff(parsed)
+			t.Errorf("%+v: round trip added %v, removed %v", opts, added, removed)
+		}
+	}
+}
+
+func TestParseDOTGuardedAlternatives(t *testing.T) {
+	fm := NewStateMachine("A")
+	if err := fm.AddTransitions(
+		&Transition{From: "A", Event: "go", To: "B", Guard: never},
+		&Transition{From: "A", Event: "go", To: "C", Guard: always},
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	graphViz, _, _ := fm.View()
+	parsed, err := ParseDOT(strings.NewReader(graphViz))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fm.Equal(parsed) {
+		added, removed := fm.Diff(parsed)
+		t.Errorf("round trip added %v, removed %v", added, removed)
+	}
+	if err := parsed.AddTransitions(&Transition{From: "A", Event: "go", To: "D"}); err == nil {
+		t.Error("the parsed machine kept DuplicateAppend")
+	}
+}
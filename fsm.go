@@ -1,73 +1,1446 @@
 package fsm
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type State string
 
+// MarshalText implements encoding.TextMarshaler.
+func (s State) MarshalText() ([]byte, error) {
+	return []byte(s), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (s *State) UnmarshalText(text []byte) error {
+	*s = State(text)
+	return nil
+}
+
 type Event string
 
-type TransitionHandler func(from State, e Event, to State) error
+// MarshalText implements encoding.TextMarshaler.
+func (e Event) MarshalText() ([]byte, error) {
+	return []byte(e), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (e *Event) UnmarshalText(text []byte) error {
+	*e = Event(text)
+	return nil
+}
+
+// AnyState can be used as a Transition's From to make it match from every
+// state that has no transition of its own for the event.
+const AnyState State = "*"
+
+// ErrUndefinedTransition is returned (wrapped) when no transition is defined
+// for a (state, event) pair.
+var ErrUndefinedTransition = errors.New("undefined")
+
+// ErrNoTransitionsDefined is returned (wrapped together with
+// ErrUndefinedTransition) when the machine has no transitions at all.
+var ErrNoTransitionsDefined = errors.New("no transitions defined")
+
+// ErrClosed is returned by Trigger after Close has been called.
+var ErrClosed = errors.New("state machine closed")
+
+// ErrFrozen is returned by the methods that change the transition table or
+// the states after Freeze has been called.
+var ErrFrozen = errors.New("state machine frozen")
+
+// ErrTimeout is returned (wrapped together with context.DeadlineExceeded) by
+// Trigger when a handler runs longer than its transition's Timeout.
+var ErrTimeout = errors.New("handler timed out")
+
+// ErrForbidden is returned (wrapped, with the reason) by Trigger for a
+// (state, event) pair declared with Forbid.
+var ErrForbidden = errors.New("forbidden")
+
+// ErrUnexpectedState is returned (wrapped) by TriggerFrom when the machine is
+// not in the expected state.
+var ErrUnexpectedState = errors.New("unexpected state")
+
+// ErrGuardRejected is returned (wrapped) by Trigger when a transition exists
+// but its Guard returned false.
+var ErrGuardRejected = errors.New("rejected by guard")
+
+// ErrReentrantTrigger is returned by Trigger and the other trigger methods,
+// with SetReentrancyCheck enabled, when they are called from a handler or
+// callback of the same machine on the goroutine running it.
+var ErrReentrantTrigger = errors.New("reentrant trigger")
+
+// ErrInvalidData is returned (wrapped, with the validator's error) by
+// TriggerWithData when the event's validator rejects the payload.
+var ErrInvalidData = errors.New("invalid data")
+
+// ErrEnterVetoed is returned (wrapped, with the callback's error) by Trigger
+// when an OnEnterVeto callback refuses the destination state.
+var ErrEnterVetoed = errors.New("enter vetoed")
+
+type TransitionHandler func(from State, e Event, to State) error
+
+func noopHandler(from State, e Event, to State) error { return nil }
+
+type ContextTransitionHandler func(ctx context.Context, from State, e Event, to State) error
+
+type DataTransitionHandler func(from State, e Event, to State, data any) error
+
+type eKey struct {
+	From  State
+	Event Event
+}
+
+type Transition struct {
+	From State
+
+	// Event may end in "*" to match every event starting with the part
+	// before it, e.g. "admin.*" for "admin.cancel". A transition for the
+	// exact event is preferred.
+	Event Event
+
+	To State
+
+	// Handle runs when the transition is taken. Like every handler field it
+	// may be nil, which declares a pure state change.
+	Handle TransitionHandler
+
+	// HandleContext, if set, is used instead of Handle and receives the
+	// context passed to TriggerContext.
+	HandleContext ContextTransitionHandler
+
+	// HandleWithData, if set, is used instead of Handle and receives the
+	// payload passed to TriggerWithData (nil for the other triggers).
+	HandleWithData DataTransitionHandler
+
+	// Timeout, if positive, bounds the handlers: HandleContext gets a
+	// context with this deadline, and once it has passed Trigger returns
+	// ErrTimeout and leaves the state unchanged, unless RunAfterStateChange
+	// is set. Handlers without a context cannot be interrupted and are only
+	// checked once they return.
+	Timeout time.Duration
+
+	// Handlers run in order after the handler above, stopping at the first
+	// error, which is then treated like an error of Handle. Handlers that
+	// already ran are not undone; use RunAfterStateChange or make them
+	// idempotent when that matters.
+	Handlers []TransitionHandler
+
+	// Resolve, if set, computes the destination when the transition is
+	// triggered instead of using To, which then only serves diagrams and
+	// analysis. The returned state must appear in the transition graph.
+	// Guard is evaluated before Resolve and still receives To.
+	Resolve func(from State, e Event) (State, error)
+
+	// Guard, if set, must return true for the transition to be taken.
+	// Several guarded transitions may share a (From, Event) key to form a
+	// decision: their guards are tried by descending Priority, then in
+	// registration order, and the first that passes is taken.
+	Guard func(from State, e Event, to State) bool
+
+	// GuardLabel names the guard in diagrams. Defaults to "guarded".
+	GuardLabel string
+
+	// Priority decides between transitions that match the same event, e.g.
+	// an exact one, an AnyState one and a wildcard pattern: the highest
+	// wins regardless of how specific the match is. Transitions of equal
+	// Priority are ordered by specificity, see Trigger.
+	Priority int
+
+	// By default the handler runs first and an error from it keeps the
+	// machine in From. With RunAfterStateChange the state is changed to To
+	// (running OnExit and OnEnter callbacks) before the handler, and a
+	// handler error is returned while the machine stays in To.
+	RunAfterStateChange bool
+
+	// Internal makes a transition whose destination is its source state an
+	// internal one: only the handler runs, while the OnExit and OnEnter
+	// callbacks are skipped and the state is not re-entered, so its timers
+	// and TimeInCurrentState keep running. A normal self-loop exits and
+	// re-enters the state. Internal has no effect on other transitions.
+	Internal bool
+
+	// Meta holds arbitrary labels such as a description or a required
+	// permission. It does not affect matching; a "description" entry is
+	// shown as the edge tooltip in Graphviz output.
+	Meta map[string]string
+}
+
+// copy returns a copy of t that shares no slices or maps with it.
+func (t *Transition) copy() Transition {
+	c := *t
+	c.Handlers = append([]TransitionHandler(nil), t.Handlers...)
+	if t.Meta != nil {
+		c.Meta = make(map[string]string, len(t.Meta))
+		for k, v := range t.Meta {
+			c.Meta[k] = v
+		}
+	}
+	return c
+}
+
+func (t *Transition) allowed(from State, e Event) bool {
+	return t.Guard == nil || t.Guard(from, e, t.To)
+}
+
+func (t *Transition) guardLabel() string {
+	if t.GuardLabel == "" {
+		return "guarded"
+	}
+	return t.GuardLabel
+}
+
+func (t *Transition) handle(ctx context.Context, from State, e Event, to State, data any) error {
+	var err error
+	switch {
+	case t.HandleContext != nil:
+		err = t.HandleContext(ctx, from, e, to)
+	case t.HandleWithData != nil:
+		err = t.HandleWithData(from, e, to, data)
+	case t.Handle != nil:
+		err = t.Handle(from, e, to)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, handle := range t.Handlers {
+		if handle == nil {
+			continue
+		}
+		if err := handle(from, e, to); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type StateMachine struct {
+	initial      State
+	current      State
+	transitions  map[eKey]*Transition
+	branches     map[eKey][]*Transition
+	wildcards    []eKey
+	shared       bool
+	disabled     map[eKey]bool
+	forbidden    map[eKey]string
+	duplicates   DuplicatePolicy
+	enterHooks   map[State][]func(from State, e Event)
+	enterVetoes  map[State][]func(from State, e Event) error
+	exitHooks    map[State][]func(to State, e Event)
+	terminals    map[State]bool
+	strict       bool
+	parents      map[State]State
+	history      *history
+	subscribers  []*subscriber
+	deniedHooks  []func(from State, e Event)
+	finalHooks   []func(state State)
+	channels     []chan Transition
+	chain        Middleware
+	wrapped      TransitionHandler
+	call         handlerCall
+	panicHandler func(recovered any) error
+	logger       Logger
+	store        Store
+	stateColors  map[State]string
+	aliases      map[Event]Event
+	validators   map[Event]func(data any) error
+	timed        map[State][]timedTransition
+	timers       []*time.Timer
+	waiters      []*waiter
+	generation   uint64
+	enteredAt    time.Time
+	timeSpent    map[State]time.Duration
+	closed       bool
+	frozen       bool
+	queue        eventQueue
+	mutex        sync.RWMutex
+
+	// published mirrors current for CurrentState, which reads it without
+	// taking the mutex.
+	published atomic.Value
+
+	// owner is the id of the goroutine holding the mutex for a trigger, or
+	// zero, see lockTrigger.
+	owner        atomic.Uint64
+	checkReentry atomic.Bool
+}
+
+func NewStateMachine(current State) *StateMachine {
+	fm := &StateMachine{initial: current, current: current, history: newHistory(), enteredAt: time.Now()}
+	fm.published.Store(current)
+	return fm
+}
+
+// CurrentState returns the current state without locking. A new state is
+// published as soon as the machine moves to it, before the OnEnter callbacks
+// run, and a caller that observes it also observes every write the
+// transition made before moving. Unlike the other methods it may be called
+// from handlers and callbacks. To read the state together with other data,
+// use Snapshot or TriggerR instead.
+func (fm *StateMachine) CurrentState() State {
+	state, _ := fm.published.Load().(State)
+	return state
+}
+
+// Clone returns an independent copy of the machine with the same states,
+// transitions and callbacks. Handlers are shared, but changing the clone's
+// transition table does not affect fm. The clone starts with an empty history,
+// no subscribers, no Store and fresh TimeInState totals.
+func (fm *StateMachine) Clone() *StateMachine {
+	fm.mutex.RLock()
+	defer fm.mutex.RUnlock()
+
+	c := NewStateMachine(fm.initial)
+	c.chain, c.panicHandler, c.strict, c.logger = fm.chain, fm.panicHandler, fm.strict, fm.logger
+	if c.chain != nil {
+		c.wrapped = c.chain(c.callHandler)
+	}
+	c.duplicates = fm.duplicates
+	c.checkReentry.Store(fm.checkReentry.Load())
+	if fm.history != nil {
+		c.history.limit, c.history.failures = fm.history.limit, fm.history.failures
+	}
+	c.transitions, c.branches = copyTable(fm.transitions, fm.branches)
+	c.wildcards = append([]eKey(nil), fm.wildcards...)
+	if fm.parents != nil {
+		c.parents = make(map[State]State, len(fm.parents))
+		for k, v := range fm.parents {
+			c.parents[k] = v
+		}
+	}
+	if fm.stateColors != nil {
+		c.stateColors = make(map[State]string, len(fm.stateColors))
+		for k, v := range fm.stateColors {
+			c.stateColors[k] = v
+		}
+	}
+	if fm.disabled != nil {
+		c.disabled = make(map[eKey]bool, len(fm.disabled))
+		for k, v := range fm.disabled {
+			c.disabled[k] = v
+		}
+	}
+	if fm.forbidden != nil {
+		c.forbidden = make(map[eKey]string, len(fm.forbidden))
+		for k, v := range fm.forbidden {
+			c.forbidden[k] = v
+		}
+	}
+	if fm.aliases != nil {
+		c.aliases = make(map[Event]Event, len(fm.aliases))
+		for k, v := range fm.aliases {
+			c.aliases[k] = v
+		}
+	}
+	if fm.validators != nil {
+		c.validators = make(map[Event]func(data any) error, len(fm.validators))
+		for k, v := range fm.validators {
+			c.validators[k] = v
+		}
+	}
+	if fm.terminals != nil {
+		c.terminals = make(map[State]bool, len(fm.terminals))
+		for k, v := range fm.terminals {
+			c.terminals[k] = v
+		}
+	}
+	if fm.timed != nil {
+		c.timed = make(map[State][]timedTransition, len(fm.timed))
+		for state, timed := range fm.timed {
+			c.timed[state] = append([]timedTransition(nil), timed...)
+		}
+	}
+	for state, hooks := range fm.enterHooks {
+		for _, fn := range hooks {
+			c.addEnterHook(state, fn)
+		}
+	}
+	for state, hooks := range fm.exitHooks {
+		for _, fn := range hooks {
+			c.addExitHook(state, fn)
+		}
+	}
+	c.deniedHooks = fm.deniedHooks[:len(fm.deniedHooks):len(fm.deniedHooks)]
+	c.finalHooks = fm.finalHooks[:len(fm.finalHooks):len(fm.finalHooks)]
+	if fm.enterVetoes != nil {
+		c.enterVetoes = make(map[State][]func(from State, e Event) error, len(fm.enterVetoes))
+		for state, vetoes := range fm.enterVetoes {
+			c.enterVetoes[state] = append([]func(from State, e Event) error(nil), vetoes...)
+		}
+	}
+
+	c.setCurrent(fm.current)
+	c.timeSpent = nil
+
+	return c
+}
+
+// InitialState returns the state the machine was created with.
+func (fm *StateMachine) InitialState() State {
+	fm.mutex.RLock()
+	defer fm.mutex.RUnlock()
+
+	return fm.initial
+}
+
+// ResetInitial moves the machine back to its initial state without running
+// any handler or callback.
+func (fm *StateMachine) ResetInitial() error {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	if err := fm.save(fm.initial); err != nil {
+		return err
+	}
+	fm.setCurrent(fm.initial)
+	return nil
+}
+
+// Close stops all background activity of the machine: the timers of timed
+// transitions and the event queue worker. Afterwards every trigger returns
+// ErrClosed, as do pending WaitForState calls, while the read-only queries
+// keep working. Close is idempotent and safe to call concurrently with
+// Trigger: in-flight triggers complete first.
+func (fm *StateMachine) Close() error {
+	fm.mutex.Lock()
+	fm.closed = true
+	fm.stopTimers()
+	fm.wakeAll(ErrClosed)
+	fm.closeChannels()
+	fm.mutex.Unlock()
+
+	fm.queue.close()
+	return nil
+}
+
+// Freeze makes the structure of the machine read-only: adding, replacing,
+// removing or renaming transitions and states, changing handlers, parents or
+// aliases and decoding JSON into it return ErrFrozen from then on. Triggers,
+// callbacks and the other settings keep working. A Clone is not frozen.
+func (fm *StateMachine) Freeze() {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	fm.frozen = true
+}
+
+// Reset moves the machine to state without running any handler or
+// callback. state must appear in the transition graph.
+func (fm *StateMachine) Reset(state State) error {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	if !fm.isKnownState(state) {
+		return fmt.Errorf("state: [%v] unknown", state)
+	}
+	if err := fm.save(state); err != nil {
+		return err
+	}
+	fm.setCurrent(state)
+	return nil
+}
+
+// OnEnter registers fn to be called every time the machine enters state.
+// Multiple callbacks per state are allowed and run in registration order.
+func (fm *StateMachine) OnEnter(state State, fn func(from State, e Event)) {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	fm.addEnterHook(state, fn)
+}
+
+func (fm *StateMachine) addEnterHook(state State, fn func(from State, e Event)) {
+	if fm.enterHooks == nil {
+		fm.enterHooks = make(map[State][]func(from State, e Event))
+	}
+	fm.enterHooks[state] = append(fm.enterHooks[state], fn)
+}
+
+// OnEnterVeto registers fn to be asked before the machine enters state. If
+// fn returns an error the transition is aborted: no exit or enter callback
+// runs and the machine stays in its previous state, while Trigger returns
+// ErrEnterVetoed wrapping the error. Unless RunAfterStateChange is set the
+// transition's handler has already run by then. Unlike a guard, fn applies
+// to every transition into state. Internal self-loops are not checked.
+func (fm *StateMachine) OnEnterVeto(state State, fn func(from State, e Event) error) {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	if fm.enterVetoes == nil {
+		fm.enterVetoes = make(map[State][]func(from State, e Event) error)
+	}
+	fm.enterVetoes[state] = append(fm.enterVetoes[state], fn)
+}
+
+// OnExit registers fn to be called every time the machine leaves state.
+// Multiple callbacks per state are allowed and run in registration order.
+func (fm *StateMachine) OnExit(state State, fn func(to State, e Event)) {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	fm.addExitHook(state, fn)
+}
+
+func (fm *StateMachine) addExitHook(state State, fn func(to State, e Event)) {
+	if fm.exitHooks == nil {
+		fm.exitHooks = make(map[State][]func(to State, e Event))
+	}
+	fm.exitHooks[state] = append(fm.exitHooks[state], fn)
+}
+
+// Trigger fires event from the current state. The order of execution is:
+// the transition's Handle, the OnExit callbacks of the old state, the state
+// change, then the OnEnter callbacks of the new state. If Handle returns an
+// error nothing else runs and the state is left unchanged. See
+// Transition.RunAfterStateChange for the reverse order.
+// A transition whose From equals To is a self-loop: Handle and the exit and
+// enter callbacks of that state run as for any other transition, and the
+// machine stays in the state. Diagrams render it as an edge to itself. See
+// Transition.Internal for a self-loop without callbacks.
+// When several transitions match event, the (From, Event) key holding the
+// highest Priority is used. Among equal priorities, the default, the most
+// specific key wins: the current state over its ancestors over AnyState and,
+// for each of these, an exact event over a wildcard pattern and a longer
+// pattern over a shorter one. The guarded alternatives of that key are then
+// tried by Priority and registration order, and the first whose guard passes
+// is taken; other keys are not tried.
+// Callbacks run while the machine is locked and must not call back into it.
+// To trigger a follow-up event from a handler use Enqueue; see
+// SetReentrancyCheck to turn such a mistake into ErrReentrantTrigger instead
+// of a deadlock.
+func (fm *StateMachine) Trigger(event Event) error {
+	return fm.TriggerContext(context.Background(), event)
+}
+
+// TriggerContext is like Trigger but passes ctx to the transition's
+// HandleContext. If ctx is already done before the handler runs, ctx.Err()
+// is returned and the state is left unchanged.
+func (fm *StateMachine) TriggerContext(ctx context.Context, event Event) error {
+	_, err := fm.trigger(ctx, event, nil)
+	return err
+}
+
+// TriggerR is like Trigger but also returns the state the machine is in
+// right after the trigger, read under the same lock.
+func (fm *StateMachine) TriggerR(event Event) (State, error) {
+	return fm.trigger(context.Background(), event, nil)
+}
+
+// TriggerWithData is like Trigger but passes data to the transition's
+// HandleWithData. The machine does not keep a reference to data. If a
+// validator is set for event, it checks data first; when it fails,
+// ErrInvalidData is returned and the transition is not attempted.
+func (fm *StateMachine) TriggerWithData(event Event, data any) error {
+	// validate takes the read lock, which would deadlock a reentrant call
+	// before lockTrigger could report it.
+	if _, err := fm.checkReentrant(); err != nil {
+		return err
+	}
+	if err := fm.validate(event, data); err != nil {
+		return err
+	}
+
+	_, err := fm.trigger(context.Background(), event, data)
+	return err
+}
+
+// SetEventValidator makes TriggerWithData check the payload of event and of
+// its aliases with fn; event may itself be an alias. fn runs before the
+// machine is locked, so it may call back into it. A nil fn removes the
+// validator.
+func (fm *StateMachine) SetEventValidator(event Event, fn func(data any) error) {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	event = fm.canonical(event)
+	if fn == nil {
+		delete(fm.validators, event)
+		return
+	}
+	if fm.validators == nil {
+		fm.validators = make(map[Event]func(data any) error)
+	}
+	fm.validators[event] = fn
+}
+
+// validate runs the validator of event, if any, on data.
+func (fm *StateMachine) validate(event Event, data any) error {
+	fm.mutex.RLock()
+	fn := fm.validators[fm.canonical(event)]
+	fm.mutex.RUnlock()
+
+	if fn == nil {
+		return nil
+	}
+	if err := fn(data); err != nil {
+		return fmt.Errorf("event: [%v] %w: %w", event, ErrInvalidData, err)
+	}
+	return nil
+}
+
+// TriggerFrom is like Trigger but first checks, under the same lock, that
+// the machine is in expected. Otherwise it returns ErrUnexpectedState and
+// nothing is run. A closed machine returns ErrClosed whatever its state.
+func (fm *StateMachine) TriggerFrom(expected State, event Event) error {
+	var after notifier
+	defer after.run()
+
+	if err := fm.lockTrigger(); err != nil {
+		return err
+	}
+	defer fm.unlockTrigger()
+
+	from := fm.current
+	if from != expected && !fm.closed {
+		return fmt.Errorf("state, event: [%v, %v] %w: expected [%v]", from, event, ErrUnexpectedState, expected)
+	}
+	_, to, moved, err := fm.fire(context.Background(), from, event, nil)
+	fm.done(&after, "", from, event, to, moved, err)
+	return err
+}
+
+// TriggerDetailed is like Trigger but also returns a copy of the transition
+// that was matched, with To set to the actual destination when it came from
+// Resolve. From is the transition's own From, which is AnyState or an
+// ancestor for inherited transitions. The zero Transition is returned if no
+// transition matched.
+func (fm *StateMachine) TriggerDetailed(event Event) (Transition, error) {
+	var after notifier
+	defer after.run()
+
+	if err := fm.lockTrigger(); err != nil {
+		return Transition{}, err
+	}
+	defer fm.unlockTrigger()
+
+	from := fm.current
+	trans, to, moved, err := fm.fire(context.Background(), from, event, nil)
+	fm.done(&after, "", from, event, to, moved, err)
+	if trans == nil {
+		return Transition{}, err
+	}
+
+	detail := trans.copy()
+	if to != "" {
+		detail.To = to
+	}
+	return detail, err
+}
+
+// TriggerIdempotent is like Trigger but treats a repeated event as done: if
+// no transition for event is defined from the current state but the machine
+// is already in the To state of a transition for event, it returns nil
+// without running any handler or callback. An event that can be triggered is
+// fired normally, so a toggle still toggles, and a forbidden or guard-rejected
+// event fails as with Trigger. This suits clients that retry events, such as
+// a second "pay success" for a paid order.
+func (fm *StateMachine) TriggerIdempotent(event Event) error {
+	var after notifier
+	defer after.run()
+
+	if err := fm.lockTrigger(); err != nil {
+		return err
+	}
+	defer fm.unlockTrigger()
+
+	from := fm.current
+	if !fm.closed {
+		if _, err := fm.lookup(from, event); errors.Is(err, ErrUndefinedTransition) && fm.leadsTo(event, from) {
+			return nil
+		}
+	}
+	_, to, moved, err := fm.fire(context.Background(), from, event, nil)
+	fm.done(&after, "", from, event, to, moved, err)
+	return err
+}
+
+// leadsTo reports whether an enabled transition for event has state as its
+// To.
+func (fm *StateMachine) leadsTo(event Event, state State) bool {
+	event = fm.canonical(event)
+	for _, trans := range fm.edges() {
+		if matchEvent(trans.Event, event) && trans.To == state && !fm.disabled[eKey{trans.From, trans.Event}] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// TriggerWithID is like Trigger but tags the transition with a correlation
+// id. The id is available to HandleContext through TransitionID and is
+// recorded in the history entry and log records of the transition.
+func (fm *StateMachine) TriggerWithID(id string, event Event) error {
+	return fm.TriggerContext(WithTransitionID(context.Background(), id), event)
+}
+
+type transitionIDKey struct{}
+
+// WithTransitionID returns a copy of ctx carrying the correlation id used by
+// TriggerWithID, for use with TriggerContext.
+func WithTransitionID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, transitionIDKey{}, id)
+}
+
+// TransitionID returns the correlation id carried by ctx, if any.
+func TransitionID(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(transitionIDKey{}).(string)
+	return id, ok
+}
+
+// trigger fires event and returns the resulting current state.
+func (fm *StateMachine) trigger(ctx context.Context, event Event, data any) (State, error) {
+	var after notifier
+	defer after.run()
+
+	if err := fm.lockTrigger(); err != nil {
+		return fm.CurrentState(), err
+	}
+	defer fm.unlockTrigger()
+
+	from := fm.current
+	id, _ := TransitionID(ctx)
+	_, to, moved, err := fm.fire(ctx, from, event, data)
+	fm.done(&after, id, from, event, to, moved, err)
+	return fm.current, err
+}
+
+// fire runs the transition for event from the current state. It returns the
+// matched transition, if any, the destination and whether the machine moved
+// there, which can be true even with an error for RunAfterStateChange
+// transitions. The caller must hold the write lock.
+func (fm *StateMachine) fire(ctx context.Context, from State, event Event, data any) (trans *Transition, to State, moved bool, err error) {
+	if fm.closed {
+		return nil, "", false, ErrClosed
+	}
+	trans, err = fm.lookup(from, event)
+	if err != nil {
+		return nil, "", false, err
+	}
+	if to, err = fm.resolve(trans, from, event); err != nil {
+		return trans, to, false, err
+	}
+	if err := ctx.Err(); err != nil {
+		return trans, to, false, err
+	}
+	if trans.Internal && to == from {
+		if err := fm.handle(ctx, trans, from, event, to, data); err != nil {
+			return trans, to, false, err
+		}
+		return trans, to, true, nil
+	}
+	if trans.RunAfterStateChange {
+		if err := fm.changeState(from, event, to); err != nil {
+			return trans, to, false, err
+		}
+		return trans, to, true, fm.handle(ctx, trans, from, event, to, data)
+	}
+	if err := fm.handle(ctx, trans, from, event, to, data); err != nil {
+		return trans, to, false, err
+	}
+	if err := fm.changeState(from, event, to); err != nil {
+		return trans, to, false, err
+	}
+	return trans, to, true, nil
+}
+
+// resolve returns the destination of trans, calling its Resolve if set.
+func (fm *StateMachine) resolve(trans *Transition, from State, event Event) (State, error) {
+	if trans.Resolve == nil {
+		return trans.To, nil
+	}
+
+	to, err := trans.Resolve(from, event)
+	if err != nil {
+		return to, err
+	}
+	if !fm.isKnownState(to) {
+		return to, fmt.Errorf("state, event: [%v, %v] resolved to unknown state [%v]", from, event, to)
+	}
+	return to, nil
+}
+
+// changeState moves the machine to to, running the exit and enter callbacks,
+// unless an enter veto refuses it or the Store fails to save to.
+func (fm *StateMachine) changeState(from State, event Event, to State) error {
+	for _, fn := range fm.enterVetoes[to] {
+		if err := fn(from, event); err != nil {
+			return fmt.Errorf("state, event: [%v, %v] %w [%v]: %w", from, event, ErrEnterVetoed, to, err)
+		}
+	}
+	if err := fm.save(to); err != nil {
+		return err
+	}
+
+	for _, fn := range fm.exitHooks[from] {
+		fn(to, event)
+	}
+	fm.setCurrent(to)
+	for _, fn := range fm.enterHooks[to] {
+		fn(from, event)
+	}
+	return nil
+}
+
+// CanTrigger reports whether event could be fired from the current state,
+// including passing its guard. No handler is run.
+func (fm *StateMachine) CanTrigger(event Event) bool {
+	fm.mutex.RLock()
+	defer fm.mutex.RUnlock()
+
+	_, err := fm.lookup(fm.current, event)
+	return err == nil
+}
+
+// NextState returns the state event leads to from from, and whether such a
+// transition exists. Guards are not evaluated and nothing is run.
+func (fm *StateMachine) NextState(from State, event Event) (State, bool) {
+	fm.mutex.RLock()
+	defer fm.mutex.RUnlock()
+
+	trans, ok := fm.match(from, event)
+	if !ok {
+		return "", false
+	}
+	return trans.To, true
+}
+
+// match returns the transition defined for event from from. The transition
+// with the highest Priority wins; among equal priorities an exact (from,
+// event) match is preferred over one of from's ancestors, and those over an
+// AnyState one, and for each of these states an exact event over a wildcard
+// pattern and a longer pattern over a shorter one. An alias is matched as
+// its canonical event and disabled transitions are skipped. Transitions
+// sharing the matched key are then ordered by lookup.
+func (fm *StateMachine) match(from State, event Event) (*Transition, bool) {
+	event = fm.canonical(event)
+
+	var (
+		best     *Transition
+		priority int
+	)
+	consider := func(k eKey) {
+		trans, ok := fm.transitions[k]
+		if !ok || fm.disabled[k] {
+			return
+		}
+		if p := fm.priority(trans); best == nil || p > priority {
+			best, priority = trans, p
+		}
+	}
+	for _, state := range append(fm.lineage(from), AnyState) {
+		consider(eKey{state, event})
+		for _, k := range fm.wildcards {
+			if k.From == state && matchEvent(k.Event, event) {
+				consider(k)
+			}
+		}
+	}
+
+	return best, best != nil
+}
+
+// indexWildcards rebuilds the list of wildcard keys used by match, longest
+// pattern first. Rebuilding is needed whenever keys are removed or renamed;
+// a new key can be added with addWildcard instead.
+func (fm *StateMachine) indexWildcards() {
+	fm.wildcards = nil
+	for k := range fm.transitions {
+		fm.addWildcard(k)
+	}
+}
+
+// addWildcard adds k to the wildcard keys if its Event is a pattern. The
+// list may be shared with a Definition, so it is copied rather than
+// appended to in place.
+func (fm *StateMachine) addWildcard(k eKey) {
+	if !isPattern(k.Event) {
+		return
+	}
+
+	wildcards := append(fm.wildcards[:len(fm.wildcards):len(fm.wildcards)], k)
+	sort.Slice(wildcards, func(i, j int) bool {
+		if len(wildcards[i].Event) != len(wildcards[j].Event) {
+			return len(wildcards[i].Event) > len(wildcards[j].Event)
+		}
+		return wildcards[i].From < wildcards[j].From
+	})
+	fm.wildcards = wildcards
+}
+
+// priority returns the highest Priority of trans and the guarded
+// alternatives registered under its key.
+func (fm *StateMachine) priority(trans *Transition) int {
+	priority := trans.Priority
+	for _, branch := range fm.branches[eKey{trans.From, trans.Event}] {
+		if branch.Priority > priority {
+			priority = branch.Priority
+		}
+	}
+
+	return priority
+}
+
+// isPattern reports whether e is a wildcard Event such as "admin.*".
+func isPattern(e Event) bool {
+	return strings.HasSuffix(string(e), "*")
+}
+
+// matchEvent reports whether event is pattern or, for a wildcard pattern,
+// starts with the part before the "*".
+func matchEvent(pattern, event Event) bool {
+	if pattern == event {
+		return true
+	}
+	return isPattern(pattern) && strings.HasPrefix(string(event), strings.TrimSuffix(string(pattern), "*"))
+}
+
+// lookup finds the transition to take for event from state and checks its
+// guard.
+func (fm *StateMachine) lookup(from State, event Event) (*Transition, error) {
+	if reason, ok := fm.forbiddenReason(from, event); ok {
+		return nil, fmt.Errorf("state, event: [%v, %v] %w: %s", from, event, ErrForbidden, reason)
+	}
+	if len(fm.transitions) == 0 {
+		return nil, fmt.Errorf("state, event: [%v, %v] %w: %w", from, event, ErrUndefinedTransition, ErrNoTransitionsDefined)
+	}
+
+	trans, ok := fm.match(from, event)
+	if !ok {
+		return nil, fmt.Errorf("state, event: [%v, %v] %w", from, event, ErrUndefinedTransition)
+	}
+	candidates := fm.candidates(trans)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Priority > candidates[j].Priority
+	})
+	for _, candidate := range candidates {
+		if candidate.allowed(from, event) {
+			return candidate, nil
+		}
+	}
+
+	return nil, fmt.Errorf("state, event: [%v, %v] %w", from, event, ErrGuardRejected)
+}
+
+// Forbid declares that event must not be triggered from from, nor from its
+// substates; AnyState forbids it everywhere. Trigger then fails with
+// ErrForbidden and reason even if a transition is defined, which stays in
+// place and is used again once Permit is called. Forbidding an alias forbids
+// its canonical event and all of its aliases.
+func (fm *StateMachine) Forbid(from State, event Event, reason string) {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	if fm.forbidden == nil {
+		fm.forbidden = make(map[eKey]string)
+	}
+	fm.forbidden[eKey{from, fm.canonical(event)}] = reason
+}
 
-type eKey struct {
-	From  State
-	Event Event
+// Permit lifts a Forbid declaration, given the same event or another alias
+// of it.
+func (fm *StateMachine) Permit(from State, event Event) {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	delete(fm.forbidden, eKey{from, fm.canonical(event)})
 }
 
-type Transition struct {
-	From   State
-	Event  Event
-	To     State
-	Handle TransitionHandler
+// forbiddenReason returns the reason event is forbidden from state, if it
+// is.
+func (fm *StateMachine) forbiddenReason(from State, event Event) (string, bool) {
+	event = fm.canonical(event)
+	for _, state := range append(fm.lineage(from), AnyState) {
+		if reason, ok := fm.forbidden[eKey{state, event}]; ok {
+			return reason, true
+		}
+	}
+
+	return "", false
 }
 
-type StateMachine struct {
-	current     State
-	transitions map[eKey]*Transition
-	mutex       sync.Mutex
+// candidates returns trans followed by the guarded transitions registered
+// after it under the same key.
+func (fm *StateMachine) candidates(trans *Transition) []*Transition {
+	return append([]*Transition{trans}, fm.branches[eKey{trans.From, trans.Event}]...)
 }
 
-func NewStateMachine(current State) *StateMachine {
-	return &StateMachine{current: current}
+// AvailableEvents returns the sorted events that have a transition defined
+// from the current state, leaving out those forbidden with Forbid.
+func (fm *StateMachine) AvailableEvents() []Event {
+	fm.mutex.RLock()
+	defer fm.mutex.RUnlock()
+
+	return fm.availableEvents(fm.current)
 }
 
-func (fm *StateMachine) CurrentState() State {
-	return fm.current
+// AvailableEventsFrom returns the sorted events that have a transition
+// defined from state, leaving out those forbidden with Forbid.
+func (fm *StateMachine) AvailableEventsFrom(state State) []Event {
+	fm.mutex.RLock()
+	defer fm.mutex.RUnlock()
+
+	return fm.availableEvents(state)
 }
 
-func (fm *StateMachine) Trigger(event Event) error {
+// availableEvents returns the events of definedEvents that are not
+// forbidden from state.
+func (fm *StateMachine) availableEvents(state State) []Event {
+	events := fm.definedEvents(state)
+	if len(fm.forbidden) == 0 {
+		return events
+	}
+
+	available := events[:0]
+	for _, event := range events {
+		if _, ok := fm.forbiddenReason(state, event); !ok {
+			available = append(available, event)
+		}
+	}
+
+	return available
+}
+
+// definedEvents returns the sorted events with an enabled transition from
+// state, including inherited and AnyState ones. Forbid does not change the
+// graph, so the structural analyses use these.
+func (fm *StateMachine) definedEvents(state State) []Event {
+	sources := map[State]bool{AnyState: true}
+	for _, s := range fm.lineage(state) {
+		sources[s] = true
+	}
+
+	set := make(map[Event]bool)
+	for k := range fm.transitions {
+		if sources[k.From] && !fm.disabled[k] {
+			set[k.Event] = true
+		}
+	}
+
+	events := make([]Event, 0, len(set))
+	for event := range set {
+		events = append(events, event)
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i] < events[j] })
+
+	return events
+}
+
+// TransitionKey identifies a transition by its From and Event, e.g. in the
+// result of IncomingEvents and in ViewOptions.EdgeWeights.
+type TransitionKey struct {
+	From  State
+	Event Event
+}
+
+// IncomingEvents returns the (from, event) pairs whose transition leads to
+// state, sorted by From then Event. From is AnyState for AnyState
+// transitions.
+func (fm *StateMachine) IncomingEvents(state State) []TransitionKey {
+	fm.mutex.RLock()
+	defer fm.mutex.RUnlock()
+
+	incoming := make([]TransitionKey, 0)
+	for _, trans := range fm.edges() {
+		pair := TransitionKey{From: trans.From, Event: trans.Event}
+		if trans.To != state || len(incoming) > 0 && incoming[len(incoming)-1] == pair {
+			continue
+		}
+		incoming = append(incoming, pair)
+	}
+
+	return incoming
+}
+
+func (fm *StateMachine) AddTransitions(transitions ...*Transition) error {
 	fm.mutex.Lock()
 	defer fm.mutex.Unlock()
 
-	if trans, ok := fm.transitions[eKey{fm.current, event}]; ok {
-		if err := trans.Handle(fm.current, event, trans.To); err != nil {
+	for _, transition := range transitions {
+		if err := fm.addTransition(transition); err != nil {
 			return err
 		}
-		fm.current = trans.To
-		return nil
 	}
 
-	return fmt.Errorf("state, event: [%v, %v] undefined", fm.current, event)
+	return nil
 }
 
-func (fm *StateMachine) AddTransitions(transitions ...*Transition) error {
+// AddTransitionsCollect is like AddTransitions but does not stop at the
+// first failure: every transition that can be added is added, and the
+// errors of the others are returned in order. It returns nil if all of them
+// were added.
+func (fm *StateMachine) AddTransitionsCollect(transitions ...*Transition) []error {
 	fm.mutex.Lock()
 	defer fm.mutex.Unlock()
 
+	var errs []error
 	for _, transition := range transitions {
 		if err := fm.addTransition(transition); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
+
+// AddOrReplaceTransitions adds transitions, replacing any existing ones with
+// the same (From, Event) key. All of them are checked before any is applied,
+// under a single lock.
+func (fm *StateMachine) AddOrReplaceTransitions(transitions ...*Transition) error {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	if fm.frozen {
+		return ErrFrozen
+	}
+	for _, transition := range transitions {
+		if transition == nil {
+			return errors.New("transition: nil")
+		}
+		if err := fm.aliasConflict(transition.From, transition.Event); err != nil {
+			return err
+		}
+	}
+
+	fm.unshare()
+	if fm.transitions == nil {
+		fm.transitions = make(map[eKey]*Transition)
+	}
+	for _, transition := range transitions {
+		key := eKey{transition.From, transition.Event}
+		if _, ok := fm.transitions[key]; !ok {
+			fm.addWildcard(key)
+		}
+		fm.transitions[key] = transition
+		delete(fm.branches, key)
+	}
+
+	return nil
+}
+
+// RemoveTransition deletes the transition (from, event), including all
+// guarded alternatives registered under it. Removing a timed transition also
+// cancels its timer.
+func (fm *StateMachine) RemoveTransition(from State, event Event) error {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	if fm.frozen {
+		return ErrFrozen
+	}
+	if _, ok := fm.transitions[eKey{from, event}]; !ok {
+		return fmt.Errorf("state, event: [%v, %v] %w", from, event, ErrUndefinedTransition)
+	}
+	fm.unshare()
+	delete(fm.transitions, eKey{from, event})
+	delete(fm.branches, eKey{from, event})
+	delete(fm.disabled, eKey{from, event})
+	if isPattern(event) {
+		fm.indexWildcards()
+	}
+	if fm.dropTimed(from, event) && from == fm.current {
+		fm.restartTimers()
+	}
+	return nil
+}
+
+// ClearTransitions removes every transition, including timed ones, so a
+// definition can be reloaded in place with AddTransitions. The current
+// state, callbacks, subscribers and history are kept.
+func (fm *StateMachine) ClearTransitions() error {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	if fm.frozen {
+		return ErrFrozen
+	}
+	fm.transitions = make(map[eKey]*Transition)
+	fm.branches = nil
+	fm.wildcards = nil
+	fm.shared = false
+	fm.disabled = nil
+	fm.timed = nil
+	fm.stopTimers()
+	return nil
+}
+
+// DisableTransition switches the transition (from, event) off without
+// removing it: Trigger and the queries treat it as undefined until
+// EnableTransition is called, and View draws it dashed.
+func (fm *StateMachine) DisableTransition(from State, event Event) error {
+	return fm.setDisabled(from, event, true)
+}
+
+// EnableTransition switches a transition disabled by DisableTransition back
+// on.
+func (fm *StateMachine) EnableTransition(from State, event Event) error {
+	return fm.setDisabled(from, event, false)
+}
+
+func (fm *StateMachine) setDisabled(from State, event Event, disabled bool) error {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	if _, ok := fm.transitions[eKey{from, event}]; !ok {
+		return fmt.Errorf("state, event: [%v, %v] %w", from, event, ErrUndefinedTransition)
+	}
+	if !disabled {
+		delete(fm.disabled, eKey{from, event})
+		return nil
+	}
+	if fm.disabled == nil {
+		fm.disabled = make(map[eKey]bool)
+	}
+	fm.disabled[eKey{from, event}] = true
+	return nil
+}
+
+// ReplaceTransition overwrites the existing transition with the same
+// (From, Event) key, dropping any guarded alternatives.
+func (fm *StateMachine) ReplaceTransition(transition *Transition) error {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	if fm.frozen {
+		return ErrFrozen
+	}
+	if transition == nil {
+		return errors.New("transition: nil")
+	}
+	if err := fm.aliasConflict(transition.From, transition.Event); err != nil {
+		return err
+	}
+	key := eKey{transition.From, transition.Event}
+	if _, ok := fm.transitions[key]; !ok {
+		return fmt.Errorf("state, event: [%v, %v] %w", transition.From, transition.Event, ErrUndefinedTransition)
+	}
+	fm.unshare()
+	fm.transitions[key] = transition
+	delete(fm.branches, key)
+	return nil
+}
+
+// AddHandler appends handle to the Handlers of the existing transition
+// (from, event).
+func (fm *StateMachine) AddHandler(from State, event Event, handle TransitionHandler) error {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	if fm.frozen {
+		return ErrFrozen
+	}
+	fm.unshare()
+	trans, ok := fm.transitions[eKey{from, event}]
+	if !ok {
+		return fmt.Errorf("state, event: [%v, %v] %w", from, event, ErrUndefinedTransition)
+	}
+	trans.Handlers = append(trans.Handlers, handle)
+	return nil
+}
+
+// SetHandler replaces the handler of the existing transition (from, event).
+func (fm *StateMachine) SetHandler(from State, event Event, handle TransitionHandler) error {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	if fm.frozen {
+		return ErrFrozen
+	}
+	fm.unshare()
+	trans, ok := fm.transitions[eKey{from, event}]
+	if !ok {
+		return fmt.Errorf("state, event: [%v, %v] %w", from, event, ErrUndefinedTransition)
+	}
+	trans.Handle = handle
+	return nil
+}
+
+// RenameState renames old to new in every transition, parent relationship
+// and per-state setting, and in the current and initial states. It fails if
+// old is not a state of the machine, or new is empty or already a state.
+func (fm *StateMachine) RenameState(old, new State) error {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	if fm.frozen {
+		return ErrFrozen
+	}
+	if old == AnyState || new == AnyState {
+		return fmt.Errorf("state: [%v] cannot be renamed", AnyState)
+	}
+	if new == "" {
+		return errors.New("state: empty name")
+	}
+	if !fm.hasState(old) {
+		return fmt.Errorf("state: [%v] unknown", old)
+	}
+	if old == new {
+		return nil
+	}
+	if fm.hasState(new) {
+		return fmt.Errorf("state: [%v] existed", new)
+	}
+	if fm.current == old {
+		if err := fm.save(new); err != nil {
 			return err
 		}
 	}
 
+	rename := func(state State) State {
+		if state == old {
+			return new
+		}
+		return state
+	}
+
+	transitions := make(map[eKey]*Transition, len(fm.transitions))
+	for k, v := range fm.transitions {
+		trans := v.copy()
+		trans.From, trans.To = rename(trans.From), rename(trans.To)
+		transitions[eKey{rename(k.From), k.Event}] = &trans
+	}
+	fm.transitions, fm.shared = transitions, false
+	fm.indexWildcards()
+
+	if fm.branches != nil {
+		branches := make(map[eKey][]*Transition, len(fm.branches))
+		for k, list := range fm.branches {
+			for _, v := range list {
+				trans := v.copy()
+				trans.From, trans.To = rename(trans.From), rename(trans.To)
+				branches[eKey{rename(k.From), k.Event}] = append(branches[eKey{rename(k.From), k.Event}], &trans)
+			}
+		}
+		fm.branches = branches
+	}
+	if fm.parents != nil {
+		parents := make(map[State]State, len(fm.parents))
+		for child, parent := range fm.parents {
+			parents[rename(child)] = rename(parent)
+		}
+		fm.parents = parents
+	}
+	if fm.disabled != nil {
+		disabled := make(map[eKey]bool, len(fm.disabled))
+		for k, v := range fm.disabled {
+			disabled[eKey{rename(k.From), k.Event}] = v
+		}
+		fm.disabled = disabled
+	}
+	if fm.forbidden != nil {
+		forbidden := make(map[eKey]string, len(fm.forbidden))
+		for k, v := range fm.forbidden {
+			forbidden[eKey{rename(k.From), k.Event}] = v
+		}
+		fm.forbidden = forbidden
+	}
+	if hooks, ok := fm.enterHooks[old]; ok {
+		delete(fm.enterHooks, old)
+		fm.enterHooks[new] = hooks
+	}
+	if hooks, ok := fm.exitHooks[old]; ok {
+		delete(fm.exitHooks, old)
+		fm.exitHooks[new] = hooks
+	}
+	if vetoes, ok := fm.enterVetoes[old]; ok {
+		delete(fm.enterVetoes, old)
+		fm.enterVetoes[new] = vetoes
+	}
+	if terminal, ok := fm.terminals[old]; ok {
+		delete(fm.terminals, old)
+		fm.terminals[new] = terminal
+	}
+	if color, ok := fm.stateColors[old]; ok {
+		delete(fm.stateColors, old)
+		fm.stateColors[new] = color
+	}
+	if timed, ok := fm.timed[old]; ok {
+		delete(fm.timed, old)
+		fm.timed[new] = timed
+	}
+	if spent, ok := fm.timeSpent[old]; ok {
+		delete(fm.timeSpent, old)
+		fm.timeSpent[new] = spent
+	}
+	fm.current, fm.initial = rename(fm.current), rename(fm.initial)
+	fm.published.Store(fm.current)
+
 	return nil
 }
 
+// copyTable returns deep copies of a transition table and its guarded
+// alternatives.
+func copyTable(transitions map[eKey]*Transition, branches map[eKey][]*Transition) (map[eKey]*Transition, map[eKey][]*Transition) {
+	var (
+		t map[eKey]*Transition
+		b map[eKey][]*Transition
+	)
+	if transitions != nil {
+		t = make(map[eKey]*Transition, len(transitions))
+		for k, v := range transitions {
+			trans := v.copy()
+			t[k] = &trans
+		}
+	}
+	if branches != nil {
+		b = make(map[eKey][]*Transition, len(branches))
+		for k, list := range branches {
+			for _, v := range list {
+				trans := v.copy()
+				b[k] = append(b[k], &trans)
+			}
+		}
+	}
+
+	return t, b
+}
+
+// unshare gives the machine its own copy of a transition table shared
+// through a Definition, before the table is changed. The caller must hold the
+// write lock.
+func (fm *StateMachine) unshare() {
+	if !fm.shared {
+		return
+	}
+
+	fm.transitions, fm.branches = copyTable(fm.transitions, fm.branches)
+	fm.shared = false
+}
+
+// hasState reports whether state appears anywhere in the machine.
+func (fm *StateMachine) hasState(state State) bool {
+	if state == fm.current || state == fm.initial || fm.isKnownState(state) {
+		return true
+	}
+	for child, parent := range fm.parents {
+		if child == state || parent == state {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (fm *StateMachine) addTransition(transition *Transition) error {
+	if fm.frozen {
+		return ErrFrozen
+	}
+	if transition == nil {
+		return errors.New("transition: nil")
+	}
+	if err := fm.aliasConflict(transition.From, transition.Event); err != nil {
+		return err
+	}
+	fm.unshare()
+
 	var (
 		from  = transition.From
 		event = transition.Event
@@ -77,127 +1450,275 @@ func (fm *StateMachine) addTransition(transition *Transition) error {
 		fm.transitions = make(map[eKey]*Transition)
 	}
 
-	if _, ok := fm.transitions[eKey{from, event}]; ok {
+	existing, ok := fm.transitions[eKey{from, event}]
+	if !ok {
+		fm.transitions[eKey{from, event}] = transition
+		fm.addWildcard(eKey{from, event})
+		return nil
+	}
+
+	guarded := transition.Guard != nil
+	for _, candidate := range fm.candidates(existing) {
+		guarded = guarded && candidate.Guard != nil
+	}
+	switch {
+	case guarded || fm.duplicates == DuplicateAppend:
+		if fm.branches == nil {
+			fm.branches = make(map[eKey][]*Transition)
+		}
+		fm.branches[eKey{from, event}] = append(fm.branches[eKey{from, event}], transition)
+	case fm.duplicates == DuplicateIgnore:
+	case fm.duplicates == DuplicateReplace:
+		fm.transitions[eKey{from, event}] = transition
+		delete(fm.branches, eKey{from, event})
+	default:
 		return fmt.Errorf("state, event: [%v, %v] existed", from, event)
 	}
 
-	fm.transitions[eKey{from, event}] = transition
 	return nil
 }
 
-// View
-// https://www.mermaidchart.com/play
-// http://www.webgraphviz.com/
-func (fm *StateMachine) View() (graphViz, flowChart, diagram string) {
+// DuplicatePolicy decides what AddTransitions does with a transition whose
+// (From, Event) key is already defined. A guarded transition added to a key
+// whose transitions are all guarded is always appended as an alternative;
+// the policy only applies to the other duplicates.
+type DuplicatePolicy int
 
-	var getSortedTransitionKeys = func(transitions map[eKey]*Transition) []eKey {
-		sortedTransitionKeys := make([]eKey, 0)
+const (
+	// DuplicateError rejects the duplicate with an error. This is the
+	// default.
+	DuplicateError DuplicatePolicy = iota
 
-		for transition := range transitions {
-			sortedTransitionKeys = append(sortedTransitionKeys, transition)
-		}
-		sort.Slice(sortedTransitionKeys, func(i, j int) bool {
-			if sortedTransitionKeys[i].From == sortedTransitionKeys[j].From {
-				return sortedTransitionKeys[i].Event < sortedTransitionKeys[j].Event
-			}
-			return sortedTransitionKeys[i].From < sortedTransitionKeys[j].From
-		})
+	// DuplicateIgnore keeps the existing transitions and drops the new one.
+	DuplicateIgnore
+
+	// DuplicateReplace replaces the existing transitions with the new one.
+	DuplicateReplace
+
+	// DuplicateAppend appends the new transition as an alternative, tried
+	// after the existing ones. Alternatives after an unguarded transition are
+	// never taken.
+	DuplicateAppend
+)
+
+// SetDuplicatePolicy sets how AddTransitions and AddTimedTransition handle
+// duplicate keys.
+func (fm *StateMachine) SetDuplicatePolicy(policy DuplicatePolicy) {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	fm.duplicates = policy
+}
+
+// States returns the sorted states referenced by transitions, plus the
+// current state.
+func (fm *StateMachine) States() []State {
+	fm.mutex.RLock()
+	defer fm.mutex.RUnlock()
+
+	return fm.sortedStates(false)
+}
+
+// GetTransition returns a copy of the transition registered under exactly
+// (from, event), without the inheritance, AnyState and wildcard matching of
+// Trigger. Of several guarded alternatives the first one is returned.
+// Changing the copy does not affect the machine.
+func (fm *StateMachine) GetTransition(from State, event Event) (*Transition, bool) {
+	fm.mutex.RLock()
+	defer fm.mutex.RUnlock()
 
-		return sortedTransitionKeys
+	trans, ok := fm.transitions[eKey{from, event}]
+	if !ok {
+		return nil, false
 	}
 
-	var getSortedStates = func(transitions map[eKey]*Transition) ([]string, map[string]string) {
-		statesToIDMap := make(map[string]string)
-		for transition, target := range transitions {
-			if _, ok := statesToIDMap[string(transition.From)]; !ok {
-				statesToIDMap[string(transition.From)] = ""
-			}
-			if _, ok := statesToIDMap[string(target.To)]; !ok {
-				statesToIDMap[string(target.To)] = ""
+	c := trans.copy()
+	return &c, true
+}
+
+// Transitions returns copies of all transitions sorted by (From, Event), the
+// guarded alternatives of a key in registration order.
+func (fm *StateMachine) Transitions() []Transition {
+	fm.mutex.RLock()
+	defer fm.mutex.RUnlock()
+
+	return fm.transitionList()
+}
+
+// Range calls fn for each transition, in no particular order, until fn
+// returns false. Unlike Transitions it neither sorts nor allocates, and t
+// shares its Handlers and Meta with the machine, so they must not be
+// modified. fn runs under the read lock and must not call any method of
+// the machine: a mutating one deadlocks at once, and a query such as States
+// deadlocks as soon as a writer is waiting, since read locks do not nest.
+func (fm *StateMachine) Range(fn func(t Transition) bool) {
+	fm.mutex.RLock()
+	defer fm.mutex.RUnlock()
+
+	for k, trans := range fm.transitions {
+		if !fn(*trans) {
+			return
+		}
+		for _, branch := range fm.branches[k] {
+			if !fn(*branch) {
+				return
 			}
 		}
+	}
+}
 
-		sortedStates := make([]string, 0, len(statesToIDMap))
-		for state := range statesToIDMap {
-			sortedStates = append(sortedStates, state)
-		}
-		sort.Strings(sortedStates)
+func (fm *StateMachine) transitionList() []Transition {
+	edges := fm.edges()
 
-		for i, state := range sortedStates {
-			statesToIDMap[state] = fmt.Sprintf("id%d", i)
-		}
-		return sortedStates, statesToIDMap
+	transitions := make([]Transition, 0, len(edges))
+	for _, trans := range edges {
+		transitions = append(transitions, trans.copy())
+	}
+
+	return transitions
+}
+
+// edges returns all transitions sorted by (From, Event), the guarded
+// alternatives of a key in registration order.
+func (fm *StateMachine) edges() []*Transition {
+	edges := make([]*Transition, 0, len(fm.transitions))
+	for _, k := range sortedKeys(fm.transitions) {
+		edges = append(edges, fm.candidates(fm.transitions[k])...)
 	}
 
-	sortedTransitionKeys := getSortedTransitionKeys(fm.transitions)
-	sortedStates, statesToIDMap := getSortedStates(fm.transitions)
+	return edges
+}
+
+// TransitionInfo describes a transition without its function values, e.g.
+// for generated documentation. Unlike Transition it can be encoded as JSON.
+type TransitionInfo struct {
+	From  State
+	Event Event
+	To    State
 
-	var bufFlowChart strings.Builder
-	{
-		// writeFlowChartGraphType
-		bufFlowChart.WriteString("graph LR\n")
+	HasGuard   bool
+	GuardLabel string
+	HasResolve bool
+	HasTimeout bool
+	Timeout    time.Duration
 
-		// writeFlowChartStates
-		for _, state := range sortedStates {
-			bufFlowChart.WriteString(fmt.Sprintf(`    %s[%s]`, statesToIDMap[state], state))
-			bufFlowChart.WriteString("\n")
-		}
-		bufFlowChart.WriteString("\n")
+	Internal            bool
+	RunAfterStateChange bool
+	Priority            int
 
-		// writeFlowChartTransitions
-		for _, transition := range sortedTransitionKeys {
-			target := fm.transitions[transition]
-			bufFlowChart.WriteString(fmt.Sprintf(`    %s --> |%s| %s`, statesToIDMap[string(transition.From)], string(transition.Event), statesToIDMap[string(target.To)]))
-			bufFlowChart.WriteString("\n")
-		}
-		bufFlowChart.WriteString("\n")
+	// Disabled is set by StateMachine.TransitionInfos for transitions
+	// switched off with DisableTransition.
+	Disabled bool
 
-		// writeFlowChartHighlightCurrent
-		const highlightingColor = "#00AA00"
-		bufFlowChart.WriteString(fmt.Sprintf(`    style %s fill:%s`, statesToIDMap[string(fm.current)], highlightingColor))
-		bufFlowChart.WriteString("\n")
+	Meta map[string]string
+}
+
+// Info returns the description of t. GuardLabel is only set for guarded
+// transitions and Internal only for self-loops, where it takes effect.
+func (t *Transition) Info() TransitionInfo {
+	c := t.copy()
+	info := TransitionInfo{
+		From:                c.From,
+		Event:               c.Event,
+		To:                  c.To,
+		HasGuard:            c.Guard != nil,
+		HasResolve:          c.Resolve != nil,
+		HasTimeout:          c.Timeout > 0,
+		Timeout:             c.Timeout,
+		Internal:            c.Internal && c.From == c.To,
+		RunAfterStateChange: c.RunAfterStateChange,
+		Priority:            c.Priority,
+		Meta:                c.Meta,
 	}
+	if info.HasGuard {
+		info.GuardLabel = c.guardLabel()
+	}
+
+	return info
+}
 
-	var bufDiagram strings.Builder
-	{
-		bufDiagram.WriteString("stateDiagram\n")
-		bufDiagram.WriteString(fmt.Sprintln(`    [*] -->`, string(fm.current)))
+// TransitionInfos returns the descriptions of all transitions in the order
+// of Transitions.
+func (fm *StateMachine) TransitionInfos() []TransitionInfo {
+	fm.mutex.RLock()
+	defer fm.mutex.RUnlock()
 
-		for _, k := range sortedTransitionKeys {
-			v := fm.transitions[k]
-			bufDiagram.WriteString(fmt.Sprintf(`    %s --> %s: %s`, string(k.From), string(v.To), string(k.Event)))
-			bufDiagram.WriteString("\n")
-		}
+	edges := fm.edges()
+
+	infos := make([]TransitionInfo, 0, len(edges))
+	for _, trans := range edges {
+		info := trans.Info()
+		info.Disabled = fm.disabled[eKey{trans.From, trans.Event}]
+		infos = append(infos, info)
 	}
 
-	var bufGraphViz strings.Builder
-	{
-		// writeHeaderLine
-		bufGraphViz.WriteString(`digraph fsm {`)
-		bufGraphViz.WriteString("\n")
+	return infos
+}
+
+// Snapshot is a consistent copy of a machine's state taken by
+// StateMachine.Snapshot.
+type Snapshot struct {
+	Initial     State
+	Current     State
+	Transitions []Transition
+	History     []HistoryEntry
+}
 
-		// writeTransitions
-		for _, k := range sortedTransitionKeys {
-			v := fm.transitions[k]
-			bufGraphViz.WriteString(fmt.Sprintf(`    "%s" -> "%s" [ label = "%s" ];`, string(k.From), string(v.To), string(k.Event)))
-			bufGraphViz.WriteString("\n")
-		}
+// Snapshot returns the current state, transitions and history, all read
+// under a single lock.
+func (fm *StateMachine) Snapshot() Snapshot {
+	fm.mutex.RLock()
+	defer fm.mutex.RUnlock()
 
-		bufGraphViz.WriteString("\n")
+	return Snapshot{
+		Initial:     fm.initial,
+		Current:     fm.current,
+		Transitions: fm.transitionList(),
+		History:     fm.history.list(),
+	}
+}
 
-		// writeStates
-		for _, k := range sortedStates {
-			if k == string(fm.current) {
-				bufGraphViz.WriteString(fmt.Sprintf(`    "%s" [color = "red"];`, k))
-			} else {
-				bufGraphViz.WriteString(fmt.Sprintf(`    "%s";`, k))
-			}
-			bufGraphViz.WriteString("\n")
+// sortedStates returns the sorted union of all From and To states and the
+// current state. AnyState is only included if withAny is set.
+func (fm *StateMachine) sortedStates(withAny bool) []State {
+	set := make(map[State]bool)
+	if fm.current != "" {
+		set[fm.current] = true
+	}
+	for k, v := range fm.transitions {
+		if k.From != AnyState || withAny {
+			set[k.From] = true
+		}
+		set[v.To] = true
+	}
+	for _, branches := range fm.branches {
+		for _, v := range branches {
+			set[v.To] = true
 		}
+	}
+
+	states := make([]State, 0, len(set))
+	for state := range set {
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i] < states[j] })
 
-		// writeFooter
-		bufGraphViz.WriteString(fmt.Sprintln("}"))
+	return states
+}
+
+// sortedKeys returns the transition keys ordered by (From, Event).
+func sortedKeys(transitions map[eKey]*Transition) []eKey {
+	sortedTransitionKeys := make([]eKey, 0, len(transitions))
+
+	for transition := range transitions {
+		sortedTransitionKeys = append(sortedTransitionKeys, transition)
 	}
+	sort.Slice(sortedTransitionKeys, func(i, j int) bool {
+		if sortedTransitionKeys[i].From == sortedTransitionKeys[j].From {
+			return sortedTransitionKeys[i].Event < sortedTransitionKeys[j].Event
+		}
+		return sortedTransitionKeys[i].From < sortedTransitionKeys[j].From
+	})
 
-	return bufGraphViz.String(), bufFlowChart.String(), bufDiagram.String()
+	return sortedTransitionKeys
 }
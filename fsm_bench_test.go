@@ -0,0 +1,49 @@
+package fsm
+
+import "testing"
+
+func benchmarkMachine(b *testing.B) *StateMachine {
+	b.Helper()
+
+	fm := NewStateMachine("A")
+	if err := fm.AddTransitions(&Transition{From: "A", Event: "tick", To: "A"}); err != nil {
+		b.Fatal(err)
+	}
+	return fm
+}
+
+// currentStateLocked is the read path CurrentState used before the state was
+// published atomically.
+func (fm *StateMachine) currentStateLocked() State {
+	fm.mutex.RLock()
+	defer fm.mutex.RUnlock()
+
+	return fm.current
+}
+
+func BenchmarkCurrentStateAtomic(b *testing.B) {
+	fm := benchmarkMachine(b)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			fm.CurrentState()
+		}
+	})
+}
+
+func BenchmarkCurrentStateRWMutex(b *testing.B) {
+	fm := benchmarkMachine(b)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			fm.currentStateLocked()
+		}
+	})
+}
+
+func BenchmarkTrigger(b *testing.B) {
+	fm := benchmarkMachine(b)
+	for i := 0; i < b.N; i++ {
+		if err := fm.Trigger("tick"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
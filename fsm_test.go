@@ -0,0 +1,206 @@
+package fsm
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestTriggerIdempotent(t *testing.T) {
+	fm := NewStateMachine("Off")
+	if err := fm.AddTransitions(
+		&Transition{From: "Off", Event: "toggle", To: "On"},
+		&Transition{From: "On", Event: "toggle", To: "Off"},
+		&Transition{From: "Unpaid", Event: "pay", To: "Paid"},
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fm.TriggerIdempotent("toggle"); err != nil || fm.CurrentState() != "On" {
+		t.Fatalf("toggle from Off: %v, state %v", err, fm.CurrentState())
+	}
+	if err := fm.TriggerIdempotent("toggle"); err != nil || fm.CurrentState() != "Off" {
+		t.Fatalf("toggle from On: %v, state %v", err, fm.CurrentState())
+	}
+
+	if err := fm.Reset("Paid"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fm.TriggerIdempotent("pay"); err != nil || fm.CurrentState() != "Paid" {
+		t.Fatalf("repeated pay: %v, state %v", err, fm.CurrentState())
+	}
+	if err := fm.TriggerIdempotent("toggle"); err == nil {
+		t.Fatal("toggle from Paid succeeded")
+	}
+
+	fm.Forbid("Paid", "pay", "compliance hold")
+	if err := fm.TriggerIdempotent("pay"); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("forbidden pay: %v, want ErrForbidden", err)
+	}
+}
+
+// TestConcurrentCurrentStateAndTrigger is meant for go test -race.
+func TestConcurrentCurrentStateAndTrigger(t *testing.T) {
+	fm := NewStateMachine("A")
+	if err := fm.AddTransitions(
+		&Transition{From: "A", Event: "flip", To: "B"},
+		&Transition{From: "B", Event: "flip", To: "A"},
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				if err := fm.Trigger("flip"); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				if state := fm.CurrentState(); state != "A" && state != "B" {
+					t.Errorf("CurrentState() = %q", state)
+					return
+				}
+				fm.AvailableEvents()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if state := fm.CurrentState(); state != "A" {
+		t.Errorf("after an even number of flips state = %v, want A", state)
+	}
+}
+
+func TestSelfLoop(t *testing.T) {
+	fm := NewStateMachine("Running")
+	var handled, exited, entered int
+	if err := fm.AddTransitions(&Transition{From: "Running", Event: "heartbeat", To: "Running", Handle: func(from State, e Event, to State) error {
+		handled++
+		return nil
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	fm.OnExit("Running", func(State, Event) { exited++ })
+	fm.OnEnter("Running", func(State, Event) { entered++ })
+
+	for i := 0; i < 3; i++ {
+		if err := fm.Trigger("heartbeat"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fm.CurrentState() != "Running" {
+		t.Errorf("state = %v, want Running", fm.CurrentState())
+	}
+	if handled != 3 || exited != 3 || entered != 3 {
+		t.Errorf("handled %d, exited %d, entered %d times, want 3 each", handled, exited, entered)
+	}
+
+	graphViz, flowChart, diagram := fm.View()
+	for name, want := range map[string]struct{ out, edge string }{
+		"Graphviz":  {graphViz, `"Running" -> "Running" [ label = "heartbeat" ];`},
+		"flowchart": {flowChart, `id0 --> |heartbeat| id0`},
+		"diagram":   {diagram, `Running --> Running: heartbeat`},
+	} {
+		if !strings.Contains(want.out, want.edge) {
+			t.Errorf("%s output lacks the self-loop %s:\n%s", name, want.edge, want.out)
+		}
+	}
+}
+
+func TestNilHandlers(t *testing.T) {
+	fm := NewStateMachine("A")
+
+	// add time: a transition without handlers is accepted, a nil one is not
+	if err := fm.AddTransitions(&Transition{From: "A", Event: "go", To: "B"}); err != nil {
+		t.Fatalf("AddTransitions without Handle: %v", err)
+	}
+	if err := fm.AddTransitions(nil); err == nil {
+		t.Error("AddTransitions(nil) succeeded")
+	}
+	if err := fm.AddOrReplaceTransitions(nil); err == nil {
+		t.Error("AddOrReplaceTransitions(nil) succeeded")
+	}
+	if err := fm.ReplaceTransition(nil); err == nil {
+		t.Error("ReplaceTransition(nil) succeeded")
+	}
+	if err := fm.AddTransitions(&Transition{From: "B", Event: "back", To: "A", Handlers: []TransitionHandler{nil}}); err != nil {
+		t.Fatalf("AddTransitions with a nil in Handlers: %v", err)
+	}
+
+	// trigger time: nil handlers are no-ops
+	if err := fm.Trigger("go"); err != nil || fm.CurrentState() != "B" {
+		t.Fatalf("Trigger(go) = %v, state %v", err, fm.CurrentState())
+	}
+	if err := fm.TriggerWithData("back", 1); err != nil || fm.CurrentState() != "A" {
+		t.Fatalf("TriggerWithData(back) = %v, state %v", err, fm.CurrentState())
+	}
+}
+
+func TestForbiddenEventsAreNotAvailable(t *testing.T) {
+	fm := NewStateMachine("A")
+	if err := fm.AddTransitions(
+		&Transition{From: "A", Event: "ship", To: "B"},
+		&Transition{From: "A", Event: "cancel", To: "C"},
+	); err != nil {
+		t.Fatal(err)
+	}
+	fm.Forbid("A", "cancel", "already paid")
+
+	if got := fm.AvailableEvents(); len(got) != 1 || got[0] != "ship" {
+		t.Errorf("AvailableEvents = %v, want [ship]", got)
+	}
+	if got := fm.OutDegree("A"); got != 1 {
+		t.Errorf("OutDegree(A) = %d, want 1", got)
+	}
+	if got := fm.Reachable("A"); len(got) != 3 {
+		t.Errorf("Reachable(A) = %v, want forbidden edges kept in the graph", got)
+	}
+
+	fm.Forbid("A", "ship", "on hold")
+	if !fm.IsTerminal() {
+		t.Error("IsTerminal = false with every event forbidden")
+	}
+	fm.Permit("A", "ship")
+	if fm.IsTerminal() {
+		t.Error("IsTerminal = true after Permit")
+	}
+}
+
+func TestTriggerFromClosed(t *testing.T) {
+	fm := NewStateMachine("A")
+	if err := fm.AddTransitions(&Transition{From: "A", Event: "go", To: "B"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fm.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []State{"A", "B"} {
+		if err := fm.TriggerFrom(expected, "go"); !errors.Is(err, ErrClosed) {
+			t.Errorf("TriggerFrom(%v) = %v, want ErrClosed", expected, err)
+		}
+	}
+}
+
+func TestRenameStateToEmpty(t *testing.T) {
+	fm := NewStateMachine("A")
+	if err := fm.AddTransitions(&Transition{From: "A", Event: "go", To: "B"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fm.RenameState("B", ""); err == nil {
+		t.Fatal("RenameState(B, \"\") succeeded")
+	}
+	if got := fm.States(); len(got) != 2 || got[0] != "A" || got[1] != "B" {
+		t.Errorf("States() = %v, want [A B]", got)
+	}
+}
@@ -0,0 +1,102 @@
+package fsm
+
+import (
+	"fmt"
+	"sync"
+)
+
+// TypedTransition is the Transition of a Machine with user-defined state and
+// event types.
+type TypedTransition[S comparable, E comparable] struct {
+	From   S
+	Event  E
+	To     S
+	Handle func(from S, e E, to S) error
+
+	// Guard, if set, must return true for the transition to be taken.
+	Guard func(from S, e E, to S) bool
+}
+
+type typedKey[S comparable, E comparable] struct {
+	From  S
+	Event E
+}
+
+// Machine is a compile-time typed variant of StateMachine for enum-like
+// state and event types, e.g. Machine[OrderState, OrderEvent]. It covers the
+// core of StateMachine: adding transitions, guards and triggering.
+type Machine[S comparable, E comparable] struct {
+	current     S
+	transitions map[typedKey[S, E]]*TypedTransition[S, E]
+	mutex       sync.RWMutex
+}
+
+func NewMachine[S comparable, E comparable](current S) *Machine[S, E] {
+	return &Machine[S, E]{current: current}
+}
+
+func (m *Machine[S, E]) CurrentState() S {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return m.current
+}
+
+// Trigger fires event from the current state. If the handler returns an
+// error the state is left unchanged.
+func (m *Machine[S, E]) Trigger(event E) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	trans, err := m.lookup(m.current, event)
+	if err != nil {
+		return err
+	}
+	if trans.Handle != nil {
+		if err := trans.Handle(m.current, event, trans.To); err != nil {
+			return err
+		}
+	}
+	m.current = trans.To
+	return nil
+}
+
+// CanTrigger reports whether event could be fired from the current state,
+// including passing its guard. No handler is run.
+func (m *Machine[S, E]) CanTrigger(event E) bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	_, err := m.lookup(m.current, event)
+	return err == nil
+}
+
+func (m *Machine[S, E]) lookup(from S, event E) (*TypedTransition[S, E], error) {
+	trans, ok := m.transitions[typedKey[S, E]{from, event}]
+	if !ok {
+		return nil, fmt.Errorf("state, event: [%v, %v] %w", from, event, ErrUndefinedTransition)
+	}
+	if trans.Guard != nil && !trans.Guard(from, event, trans.To) {
+		return nil, fmt.Errorf("state, event: [%v, %v] %w", from, event, ErrGuardRejected)
+	}
+
+	return trans, nil
+}
+
+func (m *Machine[S, E]) AddTransitions(transitions ...*TypedTransition[S, E]) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.transitions == nil {
+		m.transitions = make(map[typedKey[S, E]]*TypedTransition[S, E])
+	}
+	for _, transition := range transitions {
+		key := typedKey[S, E]{transition.From, transition.Event}
+		if _, ok := m.transitions[key]; ok {
+			return fmt.Errorf("state, event: [%v, %v] existed", transition.From, transition.Event)
+		}
+		m.transitions[key] = transition
+	}
+
+	return nil
+}
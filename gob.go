@@ -0,0 +1,31 @@
+package fsm
+
+import (
+	"bytes"
+	"encoding/gob"
+)
+
+// GobEncode implements gob.GobEncoder. It encodes the same data as
+// MarshalJSON: the initial and current states and the (from, event, to)
+// triples of all transitions, without handlers or guards, so only the first
+// of several guarded alternatives sharing a (from, event) key is kept.
+func (fm *StateMachine) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(fm.encodable()); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// GobDecode implements gob.GobDecoder. Like UnmarshalJSON it replaces the
+// machine's states and transitions with the decoded ones, which get a no-op
+// handler; use SetHandler to attach the real ones.
+func (fm *StateMachine) GobDecode(data []byte) error {
+	var v jsonStateMachine
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&v); err != nil {
+		return err
+	}
+
+	return fm.replace(v)
+}
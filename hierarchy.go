@@ -0,0 +1,83 @@
+package fsm
+
+import (
+	"fmt"
+	"sort"
+)
+
+// SetParent makes child a substate of parent. An event that child has no
+// transition for is looked up on parent, then on parent's parent and so on,
+// before AnyState transitions are considered. OnEnter and OnExit callbacks
+// only run for the concrete states of a transition. An empty parent removes
+// the relationship; cycles are rejected.
+func (fm *StateMachine) SetParent(child, parent State) error {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	if fm.frozen {
+		return ErrFrozen
+	}
+	if parent == "" {
+		delete(fm.parents, child)
+		return nil
+	}
+	if child == AnyState || parent == AnyState {
+		return fmt.Errorf("state: [%v] cannot be part of a hierarchy", AnyState)
+	}
+	for s, ok := parent, true; ok; s, ok = fm.parents[s] {
+		if s == child {
+			return fmt.Errorf("state: [%v] parent [%v] creates a cycle", child, parent)
+		}
+	}
+
+	if fm.parents == nil {
+		fm.parents = make(map[State]State)
+	}
+	fm.parents[child] = parent
+	return nil
+}
+
+// Parent returns the parent of state and whether it has one.
+func (fm *StateMachine) Parent(state State) (State, bool) {
+	fm.mutex.RLock()
+	defer fm.mutex.RUnlock()
+
+	parent, ok := fm.parents[state]
+	return parent, ok
+}
+
+// lineage returns state followed by its ancestors, nearest first.
+func (fm *StateMachine) lineage(state State) []State {
+	states := []State{state}
+	for parent, ok := fm.parents[state]; ok; parent, ok = fm.parents[parent] {
+		states = append(states, parent)
+	}
+
+	return states
+}
+
+// children returns the sorted direct substates of every parent.
+func (fm *StateMachine) children() map[State][]State {
+	children := make(map[State][]State)
+	for child, parent := range fm.parents {
+		children[parent] = append(children[parent], child)
+	}
+	for _, states := range children {
+		sort.Slice(states, func(i, j int) bool { return states[i] < states[j] })
+	}
+
+	return children
+}
+
+// roots returns the sorted parents that have no parent themselves.
+func (fm *StateMachine) roots() []State {
+	roots := make([]State, 0)
+	for parent := range fm.children() {
+		if _, ok := fm.parents[parent]; !ok {
+			roots = append(roots, parent)
+		}
+	}
+	sort.Slice(roots, func(i, j int) bool { return roots[i] < roots[j] })
+
+	return roots
+}
@@ -0,0 +1,140 @@
+package fsm
+
+import "time"
+
+const defaultHistoryLimit = 100
+
+// HistoryEntry records one Trigger call.
+type HistoryEntry struct {
+	From  State
+	Event Event
+	To    State
+	Time  time.Time
+
+	// ID is the correlation id given to TriggerWithID, if any.
+	ID string
+
+	// Failed is set for triggers that did not change the state, which are
+	// only recorded after SetHistoryFailures(true). Err holds the error
+	// returned by Trigger, if any.
+	Failed bool
+	Err    error
+}
+
+// history is a fixed size ring buffer of entries.
+type history struct {
+	entries  []HistoryEntry
+	next     int
+	full     bool
+	limit    int
+	failures bool
+}
+
+func newHistory() *history {
+	return &history{limit: defaultHistoryLimit}
+}
+
+func (h *history) add(entry HistoryEntry) {
+	if h.limit <= 0 {
+		return
+	}
+	if len(h.entries) < h.limit {
+		h.entries = append(h.entries, entry)
+		return
+	}
+	h.entries[h.next] = entry
+	h.next = (h.next + 1) % h.limit
+	h.full = true
+}
+
+// list returns the entries from oldest to newest.
+func (h *history) list() []HistoryEntry {
+	if h == nil {
+		return []HistoryEntry{}
+	}
+
+	entries := make([]HistoryEntry, 0, len(h.entries))
+	if h.full {
+		entries = append(entries, h.entries[h.next:]...)
+		entries = append(entries, h.entries[:h.next]...)
+	} else {
+		entries = append(entries, h.entries...)
+	}
+
+	return entries
+}
+
+func (h *history) setLimit(n int) {
+	entries := h.list()
+	if n < 0 {
+		n = 0
+	}
+	if len(entries) > n {
+		entries = entries[len(entries)-n:]
+	}
+
+	h.entries, h.next, h.full, h.limit = entries, 0, false, n
+}
+
+func (h *history) clear() {
+	h.entries, h.next, h.full = nil, 0, false
+}
+
+// History returns the recorded transitions from oldest to newest. By default
+// the last 100 successful transitions are kept.
+func (fm *StateMachine) History() []HistoryEntry {
+	fm.mutex.RLock()
+	defer fm.mutex.RUnlock()
+
+	return fm.history.list()
+}
+
+// SetHistoryLimit caps the number of kept entries, dropping the oldest ones.
+// A limit of 0 disables recording.
+func (fm *StateMachine) SetHistoryLimit(n int) {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	fm.writableHistory().setLimit(n)
+}
+
+// SetHistoryFailures controls whether rejected triggers are recorded too.
+func (fm *StateMachine) SetHistoryFailures(record bool) {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	fm.writableHistory().failures = record
+}
+
+// ClearHistory drops all recorded entries.
+func (fm *StateMachine) ClearHistory() {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	fm.writableHistory().clear()
+}
+
+// writableHistory returns the history, creating it for machines that were not
+// built by NewStateMachine. The caller must hold the write lock.
+func (fm *StateMachine) writableHistory() *history {
+	if fm.history == nil {
+		fm.history = newHistory()
+	}
+	return fm.history
+}
+
+func (fm *StateMachine) record(id string, from State, event Event, to State, moved bool, err error) {
+	h := fm.writableHistory()
+	if !moved && !h.failures {
+		return
+	}
+	h.add(HistoryEntry{
+		From:   from,
+		Event:  event,
+		To:     to,
+		Time:   time.Now(),
+		ID:     id,
+		Failed: !moved,
+		Err:    err,
+	})
+}
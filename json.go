@@ -0,0 +1,101 @@
+package fsm
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type jsonTransition struct {
+	From  State `json:"from"`
+	Event Event `json:"event"`
+	To    State `json:"to"`
+}
+
+type jsonStateMachine struct {
+	Initial     State            `json:"initial,omitempty"`
+	Current     State            `json:"current"`
+	Transitions []jsonTransition `json:"transitions"`
+}
+
+// MarshalJSON encodes the current state and the (from, event, to) triples of
+// all transitions. Handlers and guards are not encoded, so of several
+// guarded transitions sharing a (from, event) key only the first is.
+func (fm *StateMachine) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fm.encodable())
+}
+
+// encodable returns the serializable form of the machine shared by the JSON
+// and gob encodings.
+func (fm *StateMachine) encodable() jsonStateMachine {
+	fm.mutex.RLock()
+	defer fm.mutex.RUnlock()
+
+	v := jsonStateMachine{
+		Initial:     fm.initial,
+		Current:     fm.current,
+		Transitions: make([]jsonTransition, 0, len(fm.transitions)),
+	}
+	for _, k := range sortedKeys(fm.transitions) {
+		v.Transitions = append(v.Transitions, jsonTransition{
+			From:  k.From,
+			Event: k.Event,
+			To:    fm.transitions[k].To,
+		})
+	}
+
+	return v
+}
+
+// UnmarshalJSON replaces the machine's states and transitions with the
+// decoded ones. A missing initial state defaults to the current one.
+// Decoded transitions get a no-op handler; use SetHandler to attach the real
+// ones.
+func (fm *StateMachine) UnmarshalJSON(data []byte) error {
+	var v jsonStateMachine
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	return fm.replace(v)
+}
+
+// replace replaces the machine's states and transitions with the decoded
+// ones in v.
+func (fm *StateMachine) replace(v jsonStateMachine) error {
+	transitions := make(map[eKey]*Transition, len(v.Transitions))
+	for _, t := range v.Transitions {
+		key := eKey{t.From, t.Event}
+		if _, ok := transitions[key]; ok {
+			return fmt.Errorf("state, event: [%v, %v] existed", t.From, t.Event)
+		}
+		transitions[key] = &Transition{From: t.From, Event: t.Event, To: t.To, Handle: noopHandler}
+	}
+
+	if v.Initial == "" {
+		v.Initial = v.Current
+	}
+
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	if fm.frozen {
+		return ErrFrozen
+	}
+	for key := range transitions {
+		if err := fm.aliasConflict(key.From, key.Event); err != nil {
+			return err
+		}
+	}
+	fm.initial = v.Initial
+	fm.transitions, fm.branches, fm.shared = transitions, nil, false
+	fm.indexWildcards()
+	for state, timed := range fm.timed {
+		for _, t := range timed {
+			if _, ok := transitions[eKey{state, t.event}]; !ok {
+				fm.dropTimed(state, t.event)
+			}
+		}
+	}
+	fm.setCurrent(v.Current)
+	return nil
+}
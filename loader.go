@@ -0,0 +1,64 @@
+package fsm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// LoadFromReader builds a machine from a line-based transition table:
+//
+//	# comment
+//	from,event,to
+//
+// Blank lines and lines starting with '#' are ignored and fields are trimmed.
+// The initial state is the From of the first transition. Transitions get a
+// no-op handler; use SetHandler to attach the real ones.
+func LoadFromReader(r io.Reader) (*StateMachine, error) {
+	var (
+		fm      *StateMachine
+		scanner = bufio.NewScanner(r)
+		lineNo  = 0
+	)
+
+	for scanner.Scan() {
+		lineNo++
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, ",")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("line %d: expected from,event,to, got %q", lineNo, line)
+		}
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+			if fields[i] == "" {
+				return nil, fmt.Errorf("line %d: empty field in %q", lineNo, line)
+			}
+		}
+
+		var (
+			from  = State(fields[0])
+			event = Event(fields[1])
+			to    = State(fields[2])
+		)
+		if fm == nil {
+			fm = NewStateMachine(from)
+		}
+		if err := fm.AddTransitions(&Transition{From: from, Event: event, To: to, Handle: noopHandler}); err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if fm == nil {
+		return nil, ErrNoTransitionsDefined
+	}
+
+	return fm, nil
+}
@@ -0,0 +1,52 @@
+package fsm
+
+// Logger receives a structured record of every trigger. Its methods take a
+// message followed by alternating keys and values, so a *slog.Logger can be
+// used directly.
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+// SetLogger makes the machine log each trigger to logger: the attempt at
+// Debug level, a transition at Info, a denied event at Warn and any other
+// failure at Error. Records carry "from", "event", "to" and "error" fields,
+// plus "id" for TriggerWithID, and are written after the machine has been
+// unlocked. A nil logger, the default, disables logging.
+func (fm *StateMachine) SetLogger(logger Logger) {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	fm.logger = logger
+}
+
+// log queues the records for a finished trigger on after. The caller must
+// hold the write lock.
+func (fm *StateMachine) log(after *notifier, id string, from State, event Event, to State, moved bool, err error) {
+	logger := fm.logger
+	if logger == nil {
+		return
+	}
+
+	fields := []any{"from", from, "event", event}
+	if id != "" {
+		fields = append(fields, "id", id)
+	}
+	with := func(args ...any) []any {
+		return append(fields[:len(fields):len(fields)], args...)
+	}
+
+	after.add(func() {
+		logger.Debug("fsm: trigger", fields...)
+		switch {
+		case err == nil:
+			logger.Info("fsm: transition", with("to", to)...)
+		case denied(err):
+			logger.Warn("fsm: trigger denied", with("error", err)...)
+		default:
+			logger.Error("fsm: transition failed", with("to", to, "moved", moved, "error", err)...)
+		}
+	})
+}
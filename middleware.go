@@ -0,0 +1,98 @@
+package fsm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Middleware wraps the handler of every transition, e.g. for logging,
+// timing or panic recovery. The returned handler must call next, if at all,
+// before it returns.
+type Middleware func(next TransitionHandler) TransitionHandler
+
+// Use registers middleware around every transition's handler. Middleware
+// composes in registration order: the first one registered is the outermost.
+// The middleware functions are called here, once, to build the wrapped
+// handler that every Trigger then runs; they are not called per Trigger.
+func (fm *StateMachine) Use(middleware ...Middleware) {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	for _, mw := range middleware {
+		if fm.chain == nil {
+			fm.chain = mw
+			continue
+		}
+
+		outer, inner := fm.chain, mw
+		fm.chain = func(next TransitionHandler) TransitionHandler {
+			return outer(inner(next))
+		}
+	}
+	if fm.chain != nil {
+		fm.wrapped = fm.chain(fm.callHandler)
+	}
+}
+
+// handlerCall holds what the handler run by the wrapped middleware chain
+// needs beyond its arguments. Triggers are serialized by the write lock, so
+// one at a time is enough.
+type handlerCall struct {
+	ctx   context.Context
+	trans *Transition
+	data  any
+}
+
+// callHandler is the innermost handler of the middleware chain. It runs the
+// handler of the transition being triggered.
+func (fm *StateMachine) callHandler(from State, e Event, to State) error {
+	call := fm.call
+	return call.trans.handle(call.ctx, from, e, to, call.data)
+}
+
+// SetPanicHandler makes a panicking transition handler return the error
+// produced by fn instead of crashing; if fn returns nil a generic error is
+// returned. Either way the panic is then treated like a handler error, so
+// the transition is not taken (unless RunAfterStateChange is set). Without a
+// panic handler (the default) the panic propagates to the caller of Trigger,
+// leaving the machine unlocked and in its previous state.
+func (fm *StateMachine) SetPanicHandler(fn func(recovered any) error) {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	fm.panicHandler = fn
+}
+
+// handle runs the handler of trans through the middleware chain, within
+// trans.Timeout if set.
+func (fm *StateMachine) handle(ctx context.Context, trans *Transition, from State, event Event, to State, data any) (err error) {
+	if fm.panicHandler != nil {
+		defer func() {
+			if r := recover(); r != nil {
+				if err = fm.panicHandler(r); err == nil {
+					err = fmt.Errorf("state, event: [%v, %v] handler panic: %v", from, event, r)
+				}
+			}
+		}()
+	}
+
+	if trans.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, trans.Timeout)
+		defer cancel()
+	}
+
+	if fm.wrapped == nil {
+		err = trans.handle(ctx, from, event, to, data)
+	} else {
+		fm.call = handlerCall{ctx: ctx, trans: trans, data: data}
+		defer func() { fm.call = handlerCall{} }()
+		err = fm.wrapped(from, event, to)
+	}
+
+	if trans.Timeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("state, event: [%v, %v] %w: %w", from, event, ErrTimeout, ctx.Err())
+	}
+	return err
+}
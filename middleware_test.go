@@ -0,0 +1,57 @@
+package fsm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUseBuildsChainOnce(t *testing.T) {
+	var (
+		built int
+		order []string
+	)
+	logging := func(name string) Middleware {
+		return func(next TransitionHandler) TransitionHandler {
+			built++
+			return func(from State, e Event, to State) error {
+				order = append(order, name)
+				return next(from, e, to)
+			}
+		}
+	}
+
+	fm := NewStateMachine("A")
+	var got []any
+	if err := fm.AddTransitions(&Transition{From: "A", Event: "tick", To: "A", HandleWithData: func(from State, e Event, to State, data any) error {
+		order = append(order, "handler")
+		got = append(got, data)
+		return nil
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	fm.Use(logging("outer"), logging("inner"))
+	built = 0
+
+	for i := 0; i < 3; i++ {
+		if err := fm.TriggerWithData("tick", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if built != 0 {
+		t.Errorf("middleware built %d times during Trigger, want 0", built)
+	}
+	if want := []string{"outer", "inner", "handler"}; !reflect.DeepEqual(order[:3], want) {
+		t.Errorf("order = %v, want %v", order[:3], want)
+	}
+	if want := []any{0, 1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("handler data = %v, want %v", got, want)
+	}
+
+	c := fm.Clone()
+	if err := c.TriggerWithData("tick", 3); err != nil {
+		t.Fatal(err)
+	}
+	if got[len(got)-1] != 3 {
+		t.Errorf("clone handler data = %v, want 3", got[len(got)-1])
+	}
+}
@@ -0,0 +1,166 @@
+package fsm
+
+import (
+	"errors"
+	"testing"
+)
+
+func always(State, Event, State) bool { return true }
+func never(State, Event, State) bool  { return false }
+
+func TestMatchOrder(t *testing.T) {
+	tests := []struct {
+		name        string
+		transitions []*Transition
+		event       Event
+		want        State
+	}{
+		{
+			name: "exact over AnyState",
+			transitions: []*Transition{
+				{From: AnyState, Event: "go", To: "any"},
+				{From: "A", Event: "go", To: "exact"},
+			},
+			event: "go", want: "exact",
+		},
+		{
+			name: "exact over wildcard",
+			transitions: []*Transition{
+				{From: "A", Event: "g*", To: "wild"},
+				{From: "A", Event: "go", To: "exact"},
+			},
+			event: "go", want: "exact",
+		},
+		{
+			name: "longer pattern over shorter",
+			transitions: []*Transition{
+				{From: "A", Event: "*", To: "all"},
+				{From: "A", Event: "admin.*", To: "admin"},
+			},
+			event: "admin.cancel", want: "admin",
+		},
+		{
+			name: "own wildcard over AnyState exact",
+			transitions: []*Transition{
+				{From: AnyState, Event: "go", To: "any"},
+				{From: "A", Event: "g*", To: "wild"},
+			},
+			event: "go", want: "wild",
+		},
+		{
+			name: "priority over exact",
+			transitions: []*Transition{
+				{From: "A", Event: "go", To: "exact"},
+				{From: AnyState, Event: "go", To: "any", Priority: 100},
+			},
+			event: "go", want: "any",
+		},
+		{
+			name: "priority over longer pattern",
+			transitions: []*Transition{
+				{From: "A", Event: "admin.*", To: "admin"},
+				{From: "A", Event: "*", To: "all", Priority: 1},
+			},
+			event: "admin.cancel", want: "all",
+		},
+		{
+			name: "priority wildcard over exact",
+			transitions: []*Transition{
+				{From: "A", Event: "go", To: "exact", Priority: 1},
+				{From: AnyState, Event: "g*", To: "wild", Priority: 2},
+			},
+			event: "go", want: "wild",
+		},
+		{
+			name: "equal priority falls back to specificity",
+			transitions: []*Transition{
+				{From: AnyState, Event: "go", To: "any", Priority: 5},
+				{From: "A", Event: "go", To: "exact", Priority: 5},
+			},
+			event: "go", want: "exact",
+		},
+		{
+			name: "guarded alternatives by priority",
+			transitions: []*Transition{
+				{From: "A", Event: "go", To: "first", Guard: always},
+				{From: "A", Event: "go", To: "second", Guard: always, Priority: 1},
+			},
+			event: "go", want: "second",
+		},
+		{
+			name: "guarded alternatives by registration order",
+			transitions: []*Transition{
+				{From: "A", Event: "go", To: "first", Guard: always},
+				{From: "A", Event: "go", To: "second", Guard: always},
+			},
+			event: "go", want: "first",
+		},
+		{
+			name: "rejected high priority alternative",
+			transitions: []*Transition{
+				{From: "A", Event: "go", To: "open", Guard: always},
+				{From: "A", Event: "go", To: "closed", Guard: never, Priority: 9},
+			},
+			event: "go", want: "open",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fm := NewStateMachine("A")
+			if err := fm.AddTransitions(tt.transitions...); err != nil {
+				t.Fatal(err)
+			}
+			if err := fm.Trigger(tt.event); err != nil {
+				t.Fatal(err)
+			}
+			if got := fm.CurrentState(); got != tt.want {
+				t.Errorf("Trigger(%v) moved to %v, want %v", tt.event, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPriorityKeyIsNotFallenThrough(t *testing.T) {
+	fm := NewStateMachine("A")
+	if err := fm.AddTransitions(
+		&Transition{From: "A", Event: "go", To: "exact"},
+		&Transition{From: AnyState, Event: "go", To: "any", Guard: never, Priority: 1},
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fm.Trigger("go"); !errors.Is(err, ErrGuardRejected) {
+		t.Errorf("Trigger = %v, want ErrGuardRejected", err)
+	}
+}
+
+func TestWildcardIndex(t *testing.T) {
+	d, err := NewDefinition("A", &Transition{From: "A", Event: "a*", To: "B"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fm := d.New()
+	if err := fm.AddTransitions(&Transition{From: "A", Event: "ab*", To: "C"}); err != nil {
+		t.Fatal(err)
+	}
+	if to, _ := fm.NextState("A", "abc"); to != "C" {
+		t.Errorf("NextState(A, abc) = %v, want C", to)
+	}
+	if to, _ := d.New().NextState("A", "abc"); to != "B" {
+		t.Errorf("definition changed: NextState(A, abc) = %v, want B", to)
+	}
+
+	if err := fm.RemoveTransition("A", "ab*"); err != nil {
+		t.Fatal(err)
+	}
+	if to, _ := fm.NextState("A", "abc"); to != "B" {
+		t.Errorf("after RemoveTransition: NextState(A, abc) = %v, want B", to)
+	}
+	if err := fm.RenameState("A", "Z"); err != nil {
+		t.Fatal(err)
+	}
+	if to, ok := fm.NextState("Z", "abc"); !ok || to != "B" {
+		t.Errorf("after RenameState: NextState(Z, abc) = %v, %v", to, ok)
+	}
+}
@@ -0,0 +1,118 @@
+package fsm
+
+import "sync"
+
+type queuedEvent struct {
+	event Event
+	done  chan error
+}
+
+// eventQueue is an unbounded FIFO of events processed by a single worker.
+// It has its own lock so that enqueueing never waits for a running handler.
+type eventQueue struct {
+	mutex   sync.Mutex
+	events  []queuedEvent
+	wake    chan struct{}
+	stop    chan struct{}
+	started bool
+	closed  bool
+}
+
+// Start launches the background worker that processes enqueued events in
+// order. Calling Start again has no effect. The worker stops on Close.
+func (fm *StateMachine) Start() {
+	q := &fm.queue
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.started || q.closed {
+		return
+	}
+	q.init()
+	q.started = true
+
+	go fm.work(q.wake, q.stop)
+}
+
+// Enqueue submits event for processing by the worker launched with Start
+// and returns at once. The returned channel receives the result of the
+// trigger; it is buffered, so it can be ignored. Events enqueued before Start
+// wait for it, and events still pending on Close receive ErrClosed.
+func (fm *StateMachine) Enqueue(event Event) <-chan error {
+	q := &fm.queue
+	done := make(chan error, 1)
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.closed {
+		done <- ErrClosed
+		return done
+	}
+	q.init()
+	q.events = append(q.events, queuedEvent{event: event, done: done})
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+
+	return done
+}
+
+func (fm *StateMachine) work(wake <-chan struct{}, stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case <-wake:
+		}
+
+		for {
+			e, ok := fm.queue.pop()
+			if !ok {
+				break
+			}
+			e.done <- fm.Trigger(e.event)
+		}
+	}
+}
+
+func (q *eventQueue) init() {
+	if q.wake == nil {
+		q.wake = make(chan struct{}, 1)
+		q.stop = make(chan struct{})
+	}
+}
+
+func (q *eventQueue) pop() (queuedEvent, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if len(q.events) == 0 {
+		return queuedEvent{}, false
+	}
+	e := q.events[0]
+	q.events = q.events[1:]
+
+	return e, true
+}
+
+// close stops the worker and fails every pending event.
+func (q *eventQueue) close() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.closed {
+		return
+	}
+	q.closed = true
+	if q.stop != nil {
+		close(q.stop)
+	}
+	for _, e := range q.events {
+		e.done <- ErrClosed
+	}
+	q.events = nil
+}
@@ -0,0 +1,58 @@
+package fsm
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEnqueue(t *testing.T) {
+	fm := NewStateMachine("A")
+	defer fm.Close()
+	if err := fm.AddTransitions(
+		&Transition{From: "A", Event: "go", To: "B"},
+		&Transition{From: "B", Event: "go", To: "C"},
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	first := fm.Enqueue("go")
+	second := fm.Enqueue("go")
+	third := fm.Enqueue("go")
+	fm.Start()
+	fm.Start()
+
+	if err := <-first; err != nil {
+		t.Errorf("first = %v", err)
+	}
+	if err := <-second; err != nil {
+		t.Errorf("second = %v", err)
+	}
+	if err := <-third; !errors.Is(err, ErrUndefinedTransition) {
+		t.Errorf("third = %v, want ErrUndefinedTransition", err)
+	}
+	if state := fm.CurrentState(); state != "C" {
+		t.Errorf("state = %v, want C", state)
+	}
+}
+
+func TestEnqueueClosed(t *testing.T) {
+	fm := NewStateMachine("A")
+	if err := fm.AddTransitions(&Transition{From: "A", Event: "go", To: "B"}); err != nil {
+		t.Fatal(err)
+	}
+
+	pending := fm.Enqueue("go")
+	if err := fm.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-pending; !errors.Is(err, ErrClosed) {
+		t.Errorf("pending = %v, want ErrClosed", err)
+	}
+	if err := <-fm.Enqueue("go"); !errors.Is(err, ErrClosed) {
+		t.Errorf("after Close = %v, want ErrClosed", err)
+	}
+	fm.Start()
+	if state := fm.CurrentState(); state != "A" {
+		t.Errorf("state = %v, want A", state)
+	}
+}
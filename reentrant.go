@@ -0,0 +1,62 @@
+package fsm
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+)
+
+// SetReentrancyCheck makes Trigger and the other trigger methods return
+// ErrReentrantTrigger when called from a handler or callback running on the
+// same goroutine, instead of deadlocking. It is off by default because
+// finding the calling goroutine costs a few microseconds per trigger.
+func (fm *StateMachine) SetReentrancyCheck(enabled bool) {
+	fm.checkReentry.Store(enabled)
+}
+
+// lockTrigger takes the write lock for a trigger. With SetReentrancyCheck it
+// also records the calling goroutine as the owner and returns
+// ErrReentrantTrigger if that goroutine already owns the lock.
+func (fm *StateMachine) lockTrigger() error {
+	id, err := fm.checkReentrant()
+	if err != nil {
+		return err
+	}
+
+	fm.mutex.Lock()
+	fm.owner.Store(id)
+	return nil
+}
+
+// checkReentrant returns ErrReentrantTrigger if SetReentrancyCheck is
+// enabled and the calling goroutine holds the trigger lock. Otherwise it
+// returns the goroutine's id, or zero when the check is disabled.
+func (fm *StateMachine) checkReentrant() (uint64, error) {
+	if !fm.checkReentry.Load() {
+		return 0, nil
+	}
+
+	id := goroutineID()
+	if fm.owner.Load() == id {
+		return 0, ErrReentrantTrigger
+	}
+	return id, nil
+}
+
+func (fm *StateMachine) unlockTrigger() {
+	fm.owner.Store(0)
+	fm.mutex.Unlock()
+}
+
+// goroutineID returns the id of the calling goroutine, as printed in stack
+// traces. The runtime does not expose it otherwise.
+func goroutineID() uint64 {
+	var buf [64]byte
+	b := bytes.TrimPrefix(buf[:runtime.Stack(buf[:], false)], []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i >= 0 {
+		b = b[:i]
+	}
+
+	id, _ := strconv.ParseUint(string(b), 10, 64)
+	return id
+}
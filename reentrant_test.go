@@ -0,0 +1,83 @@
+package fsm
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReentrantTrigger(t *testing.T) {
+	fm := NewStateMachine("A")
+	fm.SetReentrancyCheck(true)
+	fm.SetEventValidator("next", func(data any) error { return nil })
+
+	var errs []error
+	if err := fm.AddTransitions(
+		&Transition{From: "A", Event: "go", To: "B", Handle: func(from State, e Event, to State) error {
+			errs = append(errs,
+				fm.Trigger("next"),
+				fm.TriggerWithData("next", 1),
+				fm.TriggerAll("next"),
+			)
+			return nil
+		}},
+		&Transition{From: "B", Event: "next", To: "C"},
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- fm.Trigger("go") }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("reentrant trigger deadlocked")
+	}
+
+	for i, err := range errs {
+		if !errors.Is(err, ErrReentrantTrigger) {
+			t.Errorf("call %d: got %v, want ErrReentrantTrigger", i, err)
+		}
+	}
+	if fm.CurrentState() != "B" {
+		t.Errorf("state = %v, want B", fm.CurrentState())
+	}
+	if err := fm.Trigger("next"); err != nil {
+		t.Errorf("Trigger after reentrant calls: %v", err)
+	}
+}
+
+func TestCloneKeepsReentrancyCheck(t *testing.T) {
+	var c *StateMachine
+	var reentrant error
+
+	fm := NewStateMachine("A")
+	fm.SetReentrancyCheck(true)
+	if err := fm.AddTransitions(
+		&Transition{From: "A", Event: "go", To: "B", Handle: func(from State, e Event, to State) error {
+			reentrant = c.Trigger("next")
+			return nil
+		}},
+		&Transition{From: "B", Event: "next", To: "C"},
+	); err != nil {
+		t.Fatal(err)
+	}
+	c = fm.Clone()
+
+	done := make(chan error, 1)
+	go func() { done <- c.Trigger("go") }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("reentrant trigger on the clone deadlocked")
+	}
+	if !errors.Is(reentrant, ErrReentrantTrigger) {
+		t.Errorf("got %v, want ErrReentrantTrigger", reentrant)
+	}
+}
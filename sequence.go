@@ -0,0 +1,142 @@
+package fsm
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// SequenceError reports the event that failed in a sequence of events.
+// Index is the position of the failing event, which is also the number of
+// events that succeeded before it.
+type SequenceError struct {
+	Index int
+	Event Event
+	Err   error
+}
+
+func (e *SequenceError) Error() string {
+	return fmt.Sprintf("event %d (%v): %v", e.Index, e.Event, e.Err)
+}
+
+func (e *SequenceError) Unwrap() error {
+	return e.Err
+}
+
+// Simulate walks events from start through the transition table and returns
+// the resulting state. Guards and Resolve functions are evaluated but no
+// handler or callback runs and the machine is not changed. On failure a
+// *SequenceError is returned.
+func (fm *StateMachine) Simulate(start State, events ...Event) (State, error) {
+	fm.mutex.RLock()
+	defer fm.mutex.RUnlock()
+
+	return fm.simulate(start, events)
+}
+
+func (fm *StateMachine) simulate(state State, events []Event) (State, error) {
+	for i, event := range events {
+		trans, err := fm.lookup(state, event)
+		if err != nil {
+			return state, &SequenceError{Index: i, Event: event, Err: err}
+		}
+		to, err := fm.resolve(trans, state, event)
+		if err != nil {
+			return state, &SequenceError{Index: i, Event: event, Err: err}
+		}
+		state = to
+	}
+
+	return state, nil
+}
+
+// TriggerAll fires events in order while holding the lock, so no other
+// trigger is interleaved. It stops at the first failure and returns a
+// *SequenceError whose Index is the number of events applied.
+func (fm *StateMachine) TriggerAll(events ...Event) error {
+	var after notifier
+	defer after.run()
+
+	if err := fm.lockTrigger(); err != nil {
+		return err
+	}
+	defer fm.unlockTrigger()
+
+	return fm.triggerAll(&after, events)
+}
+
+// TriggerAllOrNothing is like TriggerAll but first simulates the whole
+// sequence and applies nothing if any event is undefined or rejected by a
+// guard. A handler error during the real run still stops the sequence
+// part-way, since handler effects cannot be undone.
+func (fm *StateMachine) TriggerAllOrNothing(events ...Event) error {
+	var after notifier
+	defer after.run()
+
+	if err := fm.lockTrigger(); err != nil {
+		return err
+	}
+	defer fm.unlockTrigger()
+
+	if _, err := fm.simulate(fm.current, events); err != nil {
+		return err
+	}
+
+	return fm.triggerAll(&after, events)
+}
+
+func (fm *StateMachine) triggerAll(after *notifier, events []Event) error {
+	for i, event := range events {
+		from := fm.current
+		_, to, moved, err := fm.fire(context.Background(), from, event, nil)
+		fm.done(after, "", from, event, to, moved, err)
+		if err != nil {
+			return &SequenceError{Index: i, Event: event, Err: err}
+		}
+	}
+
+	return nil
+}
+
+// RandomWalk triggers up to steps events from the current state, each picked
+// by rng among the events whose guard currently passes, and returns the
+// events that succeeded in order. It stops early once no event can be
+// triggered, e.g. in a terminal state. Each step is a separate Trigger, so
+// handlers and callbacks run as usual. A nil rng uses a time-seeded source.
+func (fm *StateMachine) RandomWalk(steps int, rng *rand.Rand) []Event {
+	if rng == nil {
+		rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+
+	var walk []Event
+	for i := 0; i < steps; i++ {
+		events := fm.triggerableEvents()
+		if len(events) == 0 {
+			break
+		}
+
+		event := events[rng.Intn(len(events))]
+		if err := fm.Trigger(event); err == nil {
+			walk = append(walk, event)
+		}
+	}
+
+	return walk
+}
+
+// triggerableEvents returns the sorted available events whose guard passes
+// in the current state.
+func (fm *StateMachine) triggerableEvents() []Event {
+	fm.mutex.RLock()
+	defer fm.mutex.RUnlock()
+
+	events := make([]Event, 0)
+	for _, event := range fm.availableEvents(fm.current) {
+		if _, err := fm.lookup(fm.current, event); err == nil {
+			events = append(events, event)
+		}
+	}
+
+	return events
+}
@@ -0,0 +1,26 @@
+package fsm
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestRandomWalk(t *testing.T) {
+	fm := NewStateMachine("A")
+	if err := fm.AddTransitions(
+		&Transition{From: "A", Event: "go", To: "B"},
+		&Transition{From: "B", Event: "back", To: "A"},
+		&Transition{From: "B", Event: "end", To: "Done"},
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	if walk := fm.RandomWalk(-1, nil); len(walk) != 0 {
+		t.Errorf("RandomWalk(-1) = %v, want no events", walk)
+	}
+
+	walk := fm.RandomWalk(1000, rand.New(rand.NewSource(1)))
+	if len(walk) == 0 || walk[len(walk)-1] != "end" || fm.CurrentState() != "Done" {
+		t.Errorf("RandomWalk did not stop at the terminal state: %v, state %v", walk, fm.CurrentState())
+	}
+}
@@ -0,0 +1,55 @@
+package fsm
+
+// Stats summarizes the size of a machine's transition graph.
+type Stats struct {
+	Transitions int
+	States      int
+
+	// OutDegree maps each state to the number of events it can be
+	// triggered with, as returned by StateMachine.OutDegree.
+	OutDegree map[State]int
+}
+
+// NumTransitions returns the number of transitions, counting each guarded
+// alternative.
+func (fm *StateMachine) NumTransitions() int {
+	fm.mutex.RLock()
+	defer fm.mutex.RUnlock()
+
+	return len(fm.edges())
+}
+
+// NumStates returns the number of states, as listed by States.
+func (fm *StateMachine) NumStates() int {
+	fm.mutex.RLock()
+	defer fm.mutex.RUnlock()
+
+	return len(fm.sortedStates(false))
+}
+
+// OutDegree returns the number of events state can be triggered with,
+// counting inherited and AnyState transitions but not forbidden events.
+func (fm *StateMachine) OutDegree(state State) int {
+	fm.mutex.RLock()
+	defer fm.mutex.RUnlock()
+
+	return len(fm.availableEvents(state))
+}
+
+// Stats returns all counts under a single lock.
+func (fm *StateMachine) Stats() Stats {
+	fm.mutex.RLock()
+	defer fm.mutex.RUnlock()
+
+	states := fm.sortedStates(false)
+	stats := Stats{
+		Transitions: len(fm.edges()),
+		States:      len(states),
+		OutDegree:   make(map[State]int, len(states)),
+	}
+	for _, state := range states {
+		stats.OutDegree[state] = len(fm.availableEvents(state))
+	}
+
+	return stats
+}
@@ -0,0 +1,95 @@
+package fsm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Store persists the current state of a machine, e.g. for crash recovery.
+type Store interface {
+	Save(state State) error
+	Load() (State, error)
+}
+
+// SetStore makes the machine save its state to store after every transition.
+// Save is called before the machine moves, so if it fails the transition is
+// not taken: the machine stays in the state it was in, no exit or enter
+// callback runs and the trigger returns the error. A handler that already
+// ran is not undone. Reset, ResetInitial and renaming the current state with
+// RenameState save the new state the same way. A nil store disables saving.
+func (fm *StateMachine) SetStore(store Store) {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	fm.store = store
+}
+
+// Restore moves the machine to the state loaded from its store without
+// running any handler or callback. Like Reset, the state must appear in the
+// transition graph.
+func (fm *StateMachine) Restore() error {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	if fm.store == nil {
+		return fmt.Errorf("no store set")
+	}
+	state, err := fm.store.Load()
+	if err != nil {
+		return err
+	}
+	if !fm.isKnownState(state) {
+		return fmt.Errorf("state: [%v] unknown", state)
+	}
+	fm.setCurrent(state)
+	return nil
+}
+
+// save persists to before the machine moves there. The caller must hold
+// the write lock.
+func (fm *StateMachine) save(to State) error {
+	if fm.store == nil {
+		return nil
+	}
+	if err := fm.store.Save(to); err != nil {
+		return fmt.Errorf("state: [%v] save: %w", to, err)
+	}
+
+	return nil
+}
+
+// FileStore is a Store keeping the state in a file. Save replaces the file
+// atomically.
+type FileStore struct {
+	Path string
+}
+
+// Save writes state to the file.
+func (s FileStore) Save(state State) error {
+	tmp, err := os.CreateTemp(filepath.Dir(s.Path), filepath.Base(s.Path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(string(state) + "\n"); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.Path)
+}
+
+// Load reads the state from the file.
+func (s FileStore) Load() (State, error) {
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return "", err
+	}
+
+	return State(strings.TrimSpace(string(data))), nil
+}
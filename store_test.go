@@ -0,0 +1,77 @@
+package fsm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type failingStore struct{ err error }
+
+func (s failingStore) Save(state State) error { return s.err }
+func (s failingStore) Load() (State, error)   { return "", s.err }
+
+func TestSaveFailureLeavesStateUntouched(t *testing.T) {
+	errDisk := errors.New("disk full")
+	fm := NewStateMachine("A")
+	if err := fm.AddTransitions(&Transition{From: "A", Event: "go", To: "B"}); err != nil {
+		t.Fatal(err)
+	}
+	fm.SetStore(failingStore{errDisk})
+
+	var callbacks int
+	fm.OnExit("A", func(State, Event) { callbacks++ })
+	fm.OnEnter("B", func(State, Event) { callbacks++ })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	waited := make(chan error, 1)
+	go func() { waited <- fm.WaitForState(ctx, "B") }()
+	time.Sleep(10 * time.Millisecond)
+
+	if err := fm.Trigger("go"); !errors.Is(err, errDisk) {
+		t.Fatalf("Trigger = %v, want %v", err, errDisk)
+	}
+	if fm.CurrentState() != "A" {
+		t.Errorf("state = %v, want A", fm.CurrentState())
+	}
+	if callbacks != 0 {
+		t.Errorf("%d callbacks ran for a failed save", callbacks)
+	}
+	if err := <-waited; err == nil {
+		t.Error("WaitForState(B) returned nil although B was never entered")
+	}
+}
+
+type memoryStore struct{ state State }
+
+func (s *memoryStore) Save(state State) error { s.state = state; return nil }
+func (s *memoryStore) Load() (State, error)   { return s.state, nil }
+
+func TestResetAndRenameSave(t *testing.T) {
+	fm := NewStateMachine("A")
+	if err := fm.AddTransitions(&Transition{From: "A", Event: "go", To: "B"}); err != nil {
+		t.Fatal(err)
+	}
+	store := &memoryStore{}
+	fm.SetStore(store)
+
+	if err := fm.Reset("B"); err != nil || store.state != "B" {
+		t.Fatalf("Reset(B): %v, saved %q", err, store.state)
+	}
+	if err := fm.RenameState("B", "C"); err != nil || store.state != "C" {
+		t.Fatalf("RenameState(B, C): %v, saved %q", err, store.state)
+	}
+	if err := fm.ResetInitial(); err != nil || store.state != "A" {
+		t.Fatalf("ResetInitial: %v, saved %q", err, store.state)
+	}
+
+	fm.SetStore(failingStore{errors.New("disk full")})
+	if err := fm.Reset("C"); err == nil || fm.CurrentState() != "A" {
+		t.Errorf("Reset(C) with a failing store: %v, state %v", err, fm.CurrentState())
+	}
+	if err := fm.RenameState("A", "D"); err == nil || fm.CurrentState() != "A" {
+		t.Errorf("RenameState(A, D) with a failing store: %v, state %v", err, fm.CurrentState())
+	}
+}
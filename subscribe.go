@@ -0,0 +1,177 @@
+package fsm
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// notifier collects callbacks queued while the machine is locked so they can
+// run once the lock has been released.
+type notifier []func()
+
+func (n *notifier) add(fn func()) {
+	*n = append(*n, fn)
+}
+
+func (n *notifier) run() {
+	for _, fn := range *n {
+		fn()
+	}
+}
+
+type subscriber struct {
+	fn func(from State, e Event, to State)
+}
+
+// Subscribe registers fn to be called after every successful transition.
+// Subscribers run after the machine has been unlocked, in registration
+// order, so they may call back into the machine. Calling the returned
+// function removes the subscription; it is safe to call more than once.
+func (fm *StateMachine) Subscribe(fn func(from State, e Event, to State)) (unsubscribe func()) {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	sub := &subscriber{fn: fn}
+	fm.subscribers = append(fm.subscribers, sub)
+
+	return func() {
+		fm.mutex.Lock()
+		defer fm.mutex.Unlock()
+
+		for i, s := range fm.subscribers {
+			if s == sub {
+				fm.subscribers = append(fm.subscribers[:i:i], fm.subscribers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// SubscribeContext is like Subscribe but also removes the subscription once
+// ctx is done. The goroutine waiting for that exits as soon as either ctx is
+// done or the returned function is called.
+func (fm *StateMachine) SubscribeContext(ctx context.Context, fn func(from State, e Event, to State)) (unsubscribe func()) {
+	if ctx.Err() != nil {
+		return func() {}
+	}
+
+	unsub := fm.Subscribe(fn)
+	if ctx.Done() == nil {
+		return unsub
+	}
+
+	var (
+		stop = make(chan struct{})
+		once sync.Once
+	)
+	go func() {
+		select {
+		case <-ctx.Done():
+			unsub()
+		case <-stop:
+		}
+	}()
+
+	return func() {
+		once.Do(func() { close(stop) })
+		unsub()
+	}
+}
+
+// OnDenied registers fn to be called whenever a trigger is denied because no
+// transition is defined for the event, its guard rejected it or it is
+// forbidden. Like subscribers, fn runs after the machine has been unlocked.
+func (fm *StateMachine) OnDenied(fn func(from State, e Event)) {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	fm.deniedHooks = append(fm.deniedHooks, fn)
+}
+
+// OnFinal registers fn to be called after every transition that lands on a
+// terminal state as reported by IsTerminal: one without outgoing transitions
+// that are not forbidden, or one declared with SetTerminalStates. Like
+// subscribers, fn runs after the machine has been unlocked.
+func (fm *StateMachine) OnFinal(fn func(state State)) {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	fm.finalHooks = append(fm.finalHooks, fn)
+}
+
+// EventsBuffer is the capacity of the channels returned by Events.
+const EventsBuffer = 64
+
+// Events returns a channel that receives every successful transition, with
+// From, Event and To as taken: the state left, the event as triggered and
+// the state entered. Each call returns a new channel, so several receivers
+// each get every transition. The channel holds up to EventsBuffer
+// transitions; when it is full, further ones are dropped for that receiver
+// rather than blocking the machine. Close closes all channels, and Events on
+// a closed machine returns a closed channel.
+func (fm *StateMachine) Events() <-chan Transition {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	ch := make(chan Transition, EventsBuffer)
+	if fm.closed {
+		close(ch)
+		return ch
+	}
+	fm.channels = append(fm.channels, ch)
+
+	return ch
+}
+
+// send delivers t to the Events channels that have room for it.
+func (fm *StateMachine) send(t Transition) {
+	for _, ch := range fm.channels {
+		select {
+		case ch <- t:
+		default:
+		}
+	}
+}
+
+func (fm *StateMachine) closeChannels() {
+	for _, ch := range fm.channels {
+		close(ch)
+	}
+	fm.channels = nil
+}
+
+// denied reports whether err means the event was not accepted in the current
+// state, as opposed to a failure while running the transition.
+func denied(err error) bool {
+	return errors.Is(err, ErrUndefinedTransition) || errors.Is(err, ErrGuardRejected) || errors.Is(err, ErrForbidden)
+}
+
+// done finishes a trigger: it records history, feeds the Events channels and
+// queues the log records and the subscribers, final or denied callbacks on
+// after. The caller must hold the write lock.
+func (fm *StateMachine) done(after *notifier, id string, from State, event Event, to State, moved bool, err error) {
+	fm.record(id, from, event, to, moved, err)
+	fm.log(after, id, from, event, to, moved, err)
+	if denied(err) {
+		for _, fn := range fm.deniedHooks {
+			fn := fn
+			after.add(func() { fn(from, event) })
+		}
+	}
+	if !moved {
+		return
+	}
+
+	fm.send(Transition{From: from, Event: event, To: to})
+	for _, sub := range fm.subscribers {
+		fn := sub.fn
+		after.add(func() { fn(from, event, to) })
+	}
+	if len(fm.finalHooks) > 0 && (fm.terminals[to] || len(fm.availableEvents(to)) == 0) {
+		for _, fn := range fm.finalHooks {
+			fn := fn
+			after.add(func() { fn(to) })
+		}
+	}
+}
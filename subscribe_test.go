@@ -0,0 +1,37 @@
+package fsm
+
+import "testing"
+
+func TestCloneKeepsDeniedHooks(t *testing.T) {
+	fm := NewStateMachine("A")
+	if err := fm.AddTransitions(&Transition{From: "A", Event: "go", To: "Done"}); err != nil {
+		t.Fatal(err)
+	}
+	var denied int
+	fm.OnDenied(func(State, Event) { denied++ })
+
+	c := fm.Clone()
+	if err := c.Trigger("bogus"); err == nil {
+		t.Fatal("Trigger(bogus) succeeded")
+	}
+	if denied != 1 {
+		t.Errorf("clone ran %d denied callbacks, want 1", denied)
+	}
+}
+
+func TestCloneKeepsFinalHooks(t *testing.T) {
+	fm := NewStateMachine("A")
+	if err := fm.AddTransitions(&Transition{From: "A", Event: "go", To: "Done"}); err != nil {
+		t.Fatal(err)
+	}
+	var final []State
+	fm.OnFinal(func(state State) { final = append(final, state) })
+
+	c := fm.Clone()
+	if err := c.Trigger("go"); err != nil {
+		t.Fatal(err)
+	}
+	if len(final) != 1 || final[0] != "Done" {
+		t.Errorf("clone final callbacks saw %v, want [Done]", final)
+	}
+}
@@ -0,0 +1,155 @@
+package fsm
+
+import (
+	"context"
+	"time"
+)
+
+type timedTransition struct {
+	event Event
+	after time.Duration
+}
+
+// TimedEvent returns the event under which AddTimedTransition registers a
+// transition that fires after the given delay, e.g. "after 30m0s".
+func TimedEvent(after time.Duration) Event {
+	return Event("after " + after.String())
+}
+
+// AddTimedTransition adds a transition from from to to that fires by itself
+// once the machine has stayed in from for the given delay. The timer starts
+// every time from is entered and is cancelled when the state changes first.
+// The transition is registered under TimedEvent(after), so it also shows up
+// in View and can be triggered early. An error returned by handle keeps the
+// machine in from; the timer is not restarted. Call Close to stop all timers.
+func (fm *StateMachine) AddTimedTransition(from State, after time.Duration, to State, handle TransitionHandler) error {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	if handle == nil {
+		handle = noopHandler
+	}
+	event := TimedEvent(after)
+	transition := &Transition{From: from, Event: event, To: to, Handle: handle}
+	if err := fm.addTransition(transition); err != nil {
+		return err
+	}
+	if !fm.stored(transition) {
+		return nil
+	}
+	for _, t := range fm.timed[from] {
+		if t.event == event {
+			return nil
+		}
+	}
+
+	if fm.timed == nil {
+		fm.timed = make(map[State][]timedTransition)
+	}
+	fm.timed[from] = append(fm.timed[from], timedTransition{event: event, after: after})
+	if from == fm.current {
+		fm.startTimer(timedTransition{event: event, after: after})
+	}
+
+	return nil
+}
+
+// stored reports whether transition is in the transition table, which it is
+// not after addTransition dropped it under DuplicateIgnore.
+func (fm *StateMachine) stored(transition *Transition) bool {
+	key := eKey{transition.From, transition.Event}
+	if fm.transitions[key] == transition {
+		return true
+	}
+	for _, t := range fm.branches[key] {
+		if t == transition {
+			return true
+		}
+	}
+	return false
+}
+
+// dropTimed forgets the timer of the timed transition (from, event) and
+// reports whether there was one. The caller must hold the write lock.
+func (fm *StateMachine) dropTimed(from State, event Event) bool {
+	var (
+		kept    []timedTransition
+		dropped bool
+	)
+	for _, t := range fm.timed[from] {
+		if t.event == event {
+			dropped = true
+			continue
+		}
+		kept = append(kept, t)
+	}
+	if !dropped {
+		return false
+	}
+	if len(kept) == 0 {
+		delete(fm.timed, from)
+	} else {
+		fm.timed[from] = kept
+	}
+	return true
+}
+
+// setCurrent moves the machine to state, wakes the WaitForState callers
+// waiting for it and restarts the timers of the timed transitions leaving it.
+// It also accounts the time spent in the previous state. The caller must
+// hold the write lock.
+func (fm *StateMachine) setCurrent(state State) {
+	fm.enter()
+	fm.current = state
+	fm.published.Store(state)
+	fm.wakeWaiters(state)
+	fm.restartTimers()
+}
+
+// restartTimers stops the running timers and starts those of the timed
+// transitions leaving the current state. The caller must hold the write lock.
+func (fm *StateMachine) restartTimers() {
+	fm.generation++
+	fm.stopTimers()
+	for _, t := range fm.timed[fm.current] {
+		fm.startTimer(t)
+	}
+}
+
+func (fm *StateMachine) startTimer(t timedTransition) {
+	if fm.closed {
+		return
+	}
+
+	generation := fm.generation
+	fm.timers = append(fm.timers, time.AfterFunc(t.after, func() {
+		fm.fireTimed(generation, t.event)
+	}))
+}
+
+func (fm *StateMachine) stopTimers() {
+	for _, timer := range fm.timers {
+		timer.Stop()
+	}
+	fm.timers = nil
+}
+
+// fireTimed triggers event unless the machine has changed state since the
+// timer was started.
+func (fm *StateMachine) fireTimed(generation uint64, event Event) {
+	var after notifier
+	defer after.run()
+
+	if err := fm.lockTrigger(); err != nil {
+		return
+	}
+	defer fm.unlockTrigger()
+
+	if fm.closed || fm.generation != generation {
+		return
+	}
+
+	from := fm.current
+	_, to, moved, err := fm.fire(context.Background(), from, event, nil)
+	fm.done(&after, "", from, event, to, moved, err)
+}
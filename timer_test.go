@@ -0,0 +1,100 @@
+package fsm
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const tick = 10 * time.Millisecond
+
+func TestTimedTransitionFires(t *testing.T) {
+	fm := NewStateMachine("A")
+	defer fm.Close()
+	if err := fm.AddTimedTransition("A", tick, "B", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := fm.WaitForState(ctx, "B"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// idleTimers returns a machine in A with a timed transition from A to B that
+// is expected never to fire, and a counter of its denied triggers.
+func idleTimers(t *testing.T) (*StateMachine, *atomic.Int32) {
+	t.Helper()
+
+	fm := NewStateMachine("A")
+	t.Cleanup(func() { fm.Close() })
+	if err := fm.AddTransitions(
+		&Transition{From: "A", Event: "go", To: "C"},
+		&Transition{From: "C", Event: "back", To: "A"},
+	); err != nil {
+		t.Fatal(err)
+	}
+	if err := fm.AddTimedTransition("A", tick, "B", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var denied atomic.Int32
+	fm.OnDenied(func(State, Event) { denied.Add(1) })
+	return fm, &denied
+}
+
+func assertIdle(t *testing.T, fm *StateMachine, denied *atomic.Int32) {
+	t.Helper()
+
+	time.Sleep(5 * tick)
+	if state := fm.CurrentState(); state != "A" {
+		t.Errorf("state = %v, want A", state)
+	}
+	if n := denied.Load(); n != 0 {
+		t.Errorf("%d denied triggers, want 0", n)
+	}
+}
+
+func TestRemoveTimedTransition(t *testing.T) {
+	fm, denied := idleTimers(t)
+	if err := fm.RemoveTransition("A", TimedEvent(tick)); err != nil {
+		t.Fatal(err)
+	}
+	assertIdle(t, fm, denied)
+
+	if err := fm.Trigger("go"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fm.Trigger("back"); err != nil {
+		t.Fatal(err)
+	}
+	assertIdle(t, fm, denied)
+}
+
+func TestUnmarshalDropsTimers(t *testing.T) {
+	fm, denied := idleTimers(t)
+	data := []byte(`{"current":"A","transitions":[{"from":"A","event":"go","to":"C"}]}`)
+	if err := fm.UnmarshalJSON(data); err != nil {
+		t.Fatal(err)
+	}
+	assertIdle(t, fm, denied)
+}
+
+func TestIgnoredTimedTransition(t *testing.T) {
+	fm := NewStateMachine("A")
+	defer fm.Close()
+	fm.SetDuplicatePolicy(DuplicateIgnore)
+	if err := fm.AddTransitions(&Transition{From: "A", Event: TimedEvent(tick), To: "C"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fm.AddTimedTransition("A", tick, "B", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(5 * tick)
+	if state := fm.CurrentState(); state != "A" {
+		t.Errorf("state = %v, want A", state)
+	}
+}
@@ -0,0 +1,41 @@
+package fsm
+
+import "time"
+
+// TimeInCurrentState returns how long the machine has been in its current
+// state, since it was created or last entered the state.
+func (fm *StateMachine) TimeInCurrentState() time.Duration {
+	fm.mutex.RLock()
+	defer fm.mutex.RUnlock()
+
+	if fm.enteredAt.IsZero() {
+		return 0
+	}
+	return time.Since(fm.enteredAt)
+}
+
+// TimeInState returns the total time the machine has spent in state,
+// including the ongoing stay if it is the current state.
+func (fm *StateMachine) TimeInState(state State) time.Duration {
+	fm.mutex.RLock()
+	defer fm.mutex.RUnlock()
+
+	total := fm.timeSpent[state]
+	if state == fm.current && !fm.enteredAt.IsZero() {
+		total += time.Since(fm.enteredAt)
+	}
+	return total
+}
+
+// enter adds the time spent in the current state to its total and starts
+// timing the next one. The caller must hold the write lock.
+func (fm *StateMachine) enter() {
+	now := time.Now()
+	if !fm.enteredAt.IsZero() && fm.current != "" {
+		if fm.timeSpent == nil {
+			fm.timeSpent = make(map[State]time.Duration)
+		}
+		fm.timeSpent[fm.current] += now.Sub(fm.enteredAt)
+	}
+	fm.enteredAt = now
+}
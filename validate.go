@@ -0,0 +1,415 @@
+package fsm
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Validate checks the transition graph and returns every problem found,
+// sorted by state. A nil result means the machine is consistent.
+func (fm *StateMachine) Validate() []error {
+	fm.mutex.RLock()
+	defer fm.mutex.RUnlock()
+
+	if len(fm.transitions) == 0 {
+		return []error{ErrNoTransitionsDefined}
+	}
+
+	var errs []error
+	for _, state := range fm.unreachable() {
+		errs = append(errs, fmt.Errorf("state: [%v] unreachable", state))
+	}
+	dangling := make(map[State]bool)
+	if fm.strict {
+		for _, state := range fm.danglingTargets() {
+			dangling[state] = true
+			errs = append(errs, fmt.Errorf("state: [%v] is never a From and not declared terminal", state))
+		}
+	}
+	if fm.terminals != nil {
+		for _, state := range fm.terminalStates() {
+			if !fm.terminals[state] && !dangling[state] {
+				errs = append(errs, fmt.Errorf("state: [%v] unexpected dead end", state))
+			}
+		}
+	}
+
+	return errs
+}
+
+// SetStrict enables strict validation: Validate then also requires every
+// To state to be the From of some transition or to be declared terminal with
+// SetTerminalStates, which catches misspelled targets.
+func (fm *StateMachine) SetStrict(strict bool) {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	fm.strict = strict
+}
+
+// danglingTargets returns the sorted To states that are never an explicit
+// From and are not declared terminal.
+func (fm *StateMachine) danglingTargets() []State {
+	froms := make(map[State]bool)
+	for k := range fm.transitions {
+		froms[k.From] = true
+	}
+
+	states := make([]State, 0)
+	for _, state := range fm.sortedStates(false) {
+		if !froms[state] && !fm.terminals[state] && fm.isKnownState(state) {
+			states = append(states, state)
+		}
+	}
+
+	return states
+}
+
+// Unreachable returns the sorted states that cannot be reached from the
+// initial state, wherever the machine currently is.
+func (fm *StateMachine) Unreachable() []State {
+	fm.mutex.RLock()
+	defer fm.mutex.RUnlock()
+
+	return fm.unreachable()
+}
+
+// Reachable returns the sorted states that can be reached from the given
+// state, the state itself included. Guards are ignored.
+func (fm *StateMachine) Reachable(from State) []State {
+	fm.mutex.RLock()
+	defer fm.mutex.RUnlock()
+
+	reached := fm.reachable(from)
+
+	states := make([]State, 0, len(reached))
+	for state := range reached {
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i] < states[j] })
+
+	return states
+}
+
+func (fm *StateMachine) unreachable() []State {
+	reached := fm.reachable(fm.initial)
+	for state := range reached {
+		// a parent is active whenever one of its substates is
+		for _, ancestor := range fm.lineage(state) {
+			reached[ancestor] = true
+		}
+	}
+
+	states := make([]State, 0)
+	for _, state := range fm.sortedStates(false) {
+		if !reached[state] {
+			states = append(states, state)
+		}
+	}
+
+	return states
+}
+
+// Cycles returns every elementary cycle of the transition graph, guards
+// ignored. Each cycle starts at its smallest state and the cycles are sorted,
+// so the result is stable across calls. A self-loop is a cycle of one state.
+func (fm *StateMachine) Cycles() [][]State {
+	fm.mutex.RLock()
+	defer fm.mutex.RUnlock()
+
+	var cycles [][]State
+	for _, start := range fm.sortedStates(false) {
+		var (
+			path   = []State{start}
+			onPath = map[State]bool{start: true}
+			visit  func(state State)
+		)
+		visit = func(state State) {
+			for _, next := range fm.distinctSuccessors(state) {
+				switch {
+				case next == start:
+					cycles = append(cycles, append([]State(nil), path...))
+				case next > start && !onPath[next]:
+					onPath[next] = true
+					path = append(path, next)
+					visit(next)
+					path = path[:len(path)-1]
+					onPath[next] = false
+				}
+			}
+		}
+		visit(start)
+	}
+
+	return cycles
+}
+
+// HasCycle reports whether the transition graph contains a cycle, guards
+// ignored.
+func (fm *StateMachine) HasCycle() bool {
+	fm.mutex.RLock()
+	defer fm.mutex.RUnlock()
+
+	const (
+		visiting = 1
+		done     = 2
+	)
+	var (
+		marks = make(map[State]int)
+		visit func(state State) bool
+	)
+	visit = func(state State) bool {
+		marks[state] = visiting
+		for _, next := range fm.successors(state) {
+			if marks[next] == visiting || marks[next] == 0 && visit(next) {
+				return true
+			}
+		}
+		marks[state] = done
+		return false
+	}
+
+	for _, state := range fm.sortedStates(false) {
+		if marks[state] == 0 && visit(state) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AllPaths returns every event sequence that leads from the initial state to
+// a terminal state without visiting a state twice, guards ignored. A terminal
+// state is one without outgoing transitions or one declared with
+// SetTerminalStates. Paths longer than maxLen events are not followed; a
+// maxLen of 0 or less means no limit. The paths are distinct and listed
+// depth-first, trying events in sorted order, so the result is stable.
+func (fm *StateMachine) AllPaths(maxLen int) [][]Event {
+	fm.mutex.RLock()
+	defer fm.mutex.RUnlock()
+
+	var (
+		paths   [][]Event
+		seen    = make(map[string]bool)
+		path    []Event
+		visited = map[State]bool{fm.initial: true}
+		visit   func(state State)
+	)
+	visit = func(state State) {
+		events := fm.definedEvents(state)
+		if len(events) == 0 || fm.terminals[state] {
+			key := pathKey(path)
+			if !seen[key] {
+				seen[key] = true
+				paths = append(paths, append([]Event{}, path...))
+			}
+		}
+		if maxLen > 0 && len(path) >= maxLen {
+			return
+		}
+
+		for _, event := range events {
+			trans, ok := fm.match(state, event)
+			if !ok {
+				continue
+			}
+			for _, candidate := range fm.candidates(trans) {
+				if visited[candidate.To] {
+					continue
+				}
+				visited[candidate.To] = true
+				path = append(path, event)
+				visit(candidate.To)
+				path = path[:len(path)-1]
+				visited[candidate.To] = false
+			}
+		}
+	}
+	visit(fm.initial)
+
+	return paths
+}
+
+// NonTerminating returns the sorted states from which no terminal state can
+// be reached, neither one without outgoing transitions nor one declared with
+// SetTerminalStates: a machine entering them can never complete. Guards are
+// ignored.
+func (fm *StateMachine) NonTerminating() []State {
+	fm.mutex.RLock()
+	defer fm.mutex.RUnlock()
+
+	var (
+		states       = fm.sortedStates(false)
+		predecessors = make(map[State][]State)
+		terminating  = make(map[State]bool)
+		queue        []State
+	)
+	for _, state := range states {
+		next := fm.successors(state)
+		for _, to := range next {
+			predecessors[to] = append(predecessors[to], state)
+		}
+		if len(next) == 0 || fm.terminals[state] {
+			terminating[state] = true
+			queue = append(queue, state)
+		}
+	}
+
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+
+		for _, from := range predecessors[state] {
+			if !terminating[from] {
+				terminating[from] = true
+				queue = append(queue, from)
+			}
+		}
+	}
+
+	trapped := make([]State, 0)
+	for _, state := range states {
+		if !terminating[state] {
+			trapped = append(trapped, state)
+		}
+	}
+
+	return trapped
+}
+
+// pathKey joins path with NUL separators, which cannot be confused with the
+// events themselves the way fmt.Sprint's spaces can.
+func pathKey(path []Event) string {
+	key := make([]byte, 0, 16*len(path))
+	for _, event := range path {
+		key = append(key, string(event)...)
+		key = append(key, 0)
+	}
+
+	return string(key)
+}
+
+// TerminalStates returns the sorted states that have no outgoing transition,
+// counting AnyState transitions as outgoing from every state.
+func (fm *StateMachine) TerminalStates() []State {
+	fm.mutex.RLock()
+	defer fm.mutex.RUnlock()
+
+	return fm.terminalStates()
+}
+
+// IsTerminal reports whether the current state is terminal: AvailableEvents
+// is empty because it has no outgoing transition or all of them are
+// forbidden, or it was declared with SetTerminalStates.
+func (fm *StateMachine) IsTerminal() bool {
+	fm.mutex.RLock()
+	defer fm.mutex.RUnlock()
+
+	return fm.terminals[fm.current] || len(fm.availableEvents(fm.current)) == 0
+}
+
+// SetTerminalStates declares the states that are intentionally terminal.
+// Once set, Validate reports every other dead end as an error.
+func (fm *StateMachine) SetTerminalStates(states ...State) {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	fm.terminals = make(map[State]bool, len(states))
+	for _, state := range states {
+		fm.terminals[state] = true
+	}
+}
+
+func (fm *StateMachine) terminalStates() []State {
+	states := make([]State, 0)
+	for _, state := range fm.sortedStates(false) {
+		if len(fm.definedEvents(state)) == 0 {
+			states = append(states, state)
+		}
+	}
+
+	return states
+}
+
+// reachable returns the set of states reachable from start, start included,
+// following the same matching as Trigger but ignoring guards.
+func (fm *StateMachine) reachable(start State) map[State]bool {
+	depths := fm.depths(start)
+
+	reached := make(map[State]bool, len(depths))
+	for state := range depths {
+		reached[state] = true
+	}
+
+	return reached
+}
+
+// depths returns the length of the shortest path from start to every state
+// reachable from it.
+func (fm *StateMachine) depths(start State) map[State]int {
+	var (
+		depths = map[State]int{start: 0}
+		queue  = []State{start}
+	)
+
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+
+		for _, to := range fm.successors(state) {
+			if _, ok := depths[to]; !ok {
+				depths[to] = depths[state] + 1
+				queue = append(queue, to)
+			}
+		}
+	}
+
+	return depths
+}
+
+// successors returns the destinations of the events available from state.
+func (fm *StateMachine) successors(state State) []State {
+	events := fm.definedEvents(state)
+
+	next := make([]State, 0, len(events))
+	for _, event := range events {
+		trans, ok := fm.match(state, event)
+		if !ok {
+			continue
+		}
+		for _, candidate := range fm.candidates(trans) {
+			next = append(next, candidate.To)
+		}
+	}
+
+	return next
+}
+
+// distinctSuccessors returns the sorted destinations of state without
+// duplicates.
+func (fm *StateMachine) distinctSuccessors(state State) []State {
+	seen := make(map[State]bool)
+	next := make([]State, 0)
+	for _, to := range fm.successors(state) {
+		if !seen[to] {
+			seen[to] = true
+			next = append(next, to)
+		}
+	}
+	sort.Slice(next, func(i, j int) bool { return next[i] < next[j] })
+
+	return next
+}
+
+func (fm *StateMachine) isKnownState(state State) bool {
+	if state == AnyState {
+		return false
+	}
+	for _, v := range fm.edges() {
+		if v.From == state || v.To == state {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,41 @@
+package fsm
+
+import "testing"
+
+func TestValidateIndependentOfCurrentState(t *testing.T) {
+	fm := NewStateMachine("A")
+	if err := fm.AddTransitions(
+		&Transition{From: "A", Event: "go", To: "B"},
+		&Transition{From: "B", Event: "go", To: "C"},
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	if errs := fm.Validate(); len(errs) != 0 {
+		t.Fatalf("Validate before Trigger = %v", errs)
+	}
+	if err := fm.Trigger("go"); err != nil {
+		t.Fatal(err)
+	}
+	if errs := fm.Validate(); len(errs) != 0 {
+		t.Errorf("Validate after Trigger = %v", errs)
+	}
+	if got := fm.Unreachable(); len(got) != 0 {
+		t.Errorf("Unreachable after Trigger = %v", got)
+	}
+}
+
+func TestAllPathsDistinguishesEventsWithSpaces(t *testing.T) {
+	fm := NewStateMachine("A")
+	if err := fm.AddTransitions(
+		&Transition{From: "A", Event: "a b", To: "Done"},
+		&Transition{From: "A", Event: "a", To: "B"},
+		&Transition{From: "B", Event: "b", To: "Done"},
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	if paths := fm.AllPaths(0); len(paths) != 2 {
+		t.Errorf("AllPaths = %q, want 2 paths", paths)
+	}
+}
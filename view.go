@@ -0,0 +1,641 @@
+package fsm
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"unicode"
+)
+
+// anyStateID is the node id used for AnyState in diagram syntaxes where "*"
+// is reserved.
+const anyStateID = "any_state"
+
+var (
+	dotEscaper      = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	mermaidEscaper  = strings.NewReplacer(`#`, `#35;`, `;`, `#59;`, `"`, `#quot;`, "\n", " ")
+	plantUMLEscaper = strings.NewReplacer(`"`, `<U+0022>`, "\n", `\n`)
+)
+
+// dotText escapes s for use inside a double-quoted Graphviz string.
+func dotText(s string) string {
+	return dotEscaper.Replace(s)
+}
+
+// mermaidText returns s as Mermaid flowchart text, quoted when it contains
+// characters that Mermaid would parse as syntax.
+func mermaidText(s string) string {
+	if !strings.ContainsAny(s, "\"[](){}|<>#;`&\n") {
+		return s
+	}
+	return `"` + mermaidEscaper.Replace(s) + `"`
+}
+
+// isIdentifier reports whether s can be used as a state name in Mermaid
+// stateDiagram and PlantUML without declaring an alias.
+func isIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// diagramAliases returns the identifiers to use in Mermaid stateDiagram and
+// PlantUML output for states whose names are not plain identifiers, such as
+// AnyState, whose "*" means the initial pseudo state there.
+func diagramAliases(states []State, stable bool) map[State]string {
+	ids := stateIDs("s", states, stable)
+
+	aliases := make(map[State]string)
+	for _, state := range states {
+		if state == AnyState {
+			aliases[state] = anyStateID
+		} else if !isIdentifier(string(state)) {
+			aliases[state] = ids[state]
+		}
+	}
+
+	return aliases
+}
+
+// stateIDs numbers states with prefix in the given order, or with stable
+// derives each id from a hash of the state name so that it does not depend
+// on the other states. Colliding hashes get a numeric suffix.
+func stateIDs(prefix string, states []State, stable bool) map[State]string {
+	ids := make(map[State]string, len(states))
+	used := make(map[string]bool, len(states))
+	for i, state := range states {
+		if !stable {
+			ids[state] = fmt.Sprintf("%s%d", prefix, i)
+			continue
+		}
+
+		h := fnv.New32a()
+		h.Write([]byte(state))
+		id := fmt.Sprintf("%s%08x", prefix, h.Sum32())
+		for n := 2; used[id]; n++ {
+			id = fmt.Sprintf("%s%08x_%d", prefix, h.Sum32(), n)
+		}
+		used[id] = true
+		ids[state] = id
+	}
+
+	return ids
+}
+
+// diagramLabel returns the label declared for an aliased state.
+func diagramLabel(state State) string {
+	if state == AnyState {
+		return "any state"
+	}
+	return string(state)
+}
+
+func diagramName(aliases map[State]string, state State) string {
+	if alias, ok := aliases[state]; ok {
+		return alias
+	}
+	return string(state)
+}
+
+// writeHierarchy writes the states grouped by SetParent as nested blocks,
+// one line each: open starts the block of a parent, item names a leaf child
+// and end closes a block.
+func (fm *StateMachine) writeHierarchy(buf *strings.Builder, indent string, open func(parent State) string, item func(child State) string, end string) {
+	children := fm.children()
+
+	var write func(parent State, indent string)
+	write = func(parent State, indent string) {
+		buf.WriteString(indent + open(parent) + "\n")
+		for _, child := range children[parent] {
+			if _, ok := children[child]; ok {
+				write(child, indent+"    ")
+			} else {
+				buf.WriteString(indent + "    " + item(child) + "\n")
+			}
+		}
+		buf.WriteString(indent + end + "\n")
+	}
+
+	for _, root := range fm.roots() {
+		write(root, indent)
+	}
+}
+
+// writeRanks writes one Graphviz rank group per breadth-first depth from the
+// initial state. The initial state is the source rank and the terminal states
+// share the sink rank; unreachable states are left unranked.
+func (fm *StateMachine) writeRanks(buf *strings.Builder) {
+	var (
+		depths   = fm.depths(fm.initial)
+		terminal = make(map[State]bool)
+		groups   [][]State
+		sinks    []State
+	)
+	for _, state := range fm.terminalStates() {
+		terminal[state] = true
+	}
+	for _, state := range fm.sortedStates(false) {
+		depth, ok := depths[state]
+		switch {
+		case !ok:
+		case terminal[state] && depth > 0:
+			sinks = append(sinks, state)
+		default:
+			for len(groups) <= depth {
+				groups = append(groups, nil)
+			}
+			groups[depth] = append(groups[depth], state)
+		}
+	}
+
+	write := func(rank string, states []State) {
+		if len(states) == 0 {
+			return
+		}
+		buf.WriteString(fmt.Sprintf("    { rank = %s;", rank))
+		for _, state := range states {
+			buf.WriteString(fmt.Sprintf(` "%s";`, dotText(string(state))))
+		}
+		buf.WriteString(" }\n")
+	}
+	for depth, states := range groups {
+		if depth == 0 {
+			write("source", states)
+		} else {
+			write("same", states)
+		}
+	}
+	write("sink", sinks)
+}
+
+// penWidth scales weight to a Graphviz penwidth between 1 and 5.
+func penWidth(weight, maxWeight int) float64 {
+	if weight <= 0 || maxWeight <= 0 {
+		return 1
+	}
+	return 1 + 4*float64(weight)/float64(maxWeight)
+}
+
+// colorGroups returns the sorted colors set with SetStateColor and, for each
+// of them, the comma separated names of the states using it.
+func (fm *StateMachine) colorGroups() ([]string, map[string]string) {
+	states := make([]State, 0, len(fm.stateColors))
+	for state := range fm.stateColors {
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i] < states[j] })
+
+	var (
+		colors  []string
+		colored = make(map[string]string)
+	)
+	for _, state := range states {
+		color := fm.stateColors[state]
+		if names, ok := colored[color]; ok {
+			colored[color] = names + ", " + string(state)
+			continue
+		}
+		colors = append(colors, color)
+		colored[color] = string(state)
+	}
+	sort.Strings(colors)
+
+	return colors, colored
+}
+
+// SetStateColor sets the fill color of state in the Graphviz and Mermaid
+// flowchart output of View, e.g. to tell error states from success states.
+// The current state is still highlighted, with a bold border. An empty color
+// removes the setting.
+func (fm *StateMachine) SetStateColor(state State, color string) {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	if color == "" {
+		delete(fm.stateColors, state)
+		return
+	}
+	if fm.stateColors == nil {
+		fm.stateColors = make(map[State]string)
+	}
+	fm.stateColors[state] = color
+}
+
+// ViewOptions customizes the output of ViewWith. The zero value reproduces
+// View.
+type ViewOptions struct {
+	// CurrentFill is the fill color of the current state. Defaults to
+	// "#00AA00" in the Mermaid flowchart and to no fill in Graphviz.
+	CurrentFill string
+
+	// CurrentStroke is the border color of the current state. Defaults to
+	// "red" in Graphviz and to no border in the Mermaid flowchart.
+	CurrentStroke string
+
+	// DisableHighlight renders the current state like any other state.
+	DisableHighlight bool
+
+	// RankByDepth groups the Graphviz nodes into ranks by their distance
+	// from the initial state, with the initial state at the top and the
+	// terminal states at the bottom.
+	RankByDepth bool
+
+	// Legend adds a legend to the Graphviz and Mermaid flowchart output that
+	// shows the current state highlighting and lists the states of every
+	// color set with SetStateColor.
+	Legend bool
+
+	// EdgeWeights, e.g. counted from History, turn the Graphviz output into
+	// a heatmap: the weight of each listed transition is added to its label
+	// and its edge is drawn thicker the higher the weight.
+	EdgeWeights map[TransitionKey]int
+
+	// StableIDs derives the node ids of the Mermaid and PlantUML output from
+	// a hash of the state names instead of numbering the states in order,
+	// so adding or removing a state does not rename the others and
+	// committed diagrams diff cleanly.
+	StableIDs bool
+}
+
+// DiagramSet holds the renderings of the machine returned by ViewAll.
+type DiagramSet struct {
+	// Graphviz is the DOT digraph.
+	Graphviz string
+
+	// MermaidFlowchart is the Mermaid flowchart.
+	MermaidFlowchart string
+
+	// MermaidState is the Mermaid stateDiagram.
+	MermaidState string
+
+	// PlantUML is the PlantUML state diagram.
+	PlantUML string
+}
+
+// View
+// https://www.mermaidchart.com/play
+// http://www.webgraphviz.com/
+func (fm *StateMachine) View() (graphViz, flowChart, diagram string) {
+	set := fm.ViewAll()
+	return set.Graphviz, set.MermaidFlowchart, set.MermaidState
+}
+
+// ViewAll returns every rendering of the machine, taken from one consistent
+// state.
+func (fm *StateMachine) ViewAll() DiagramSet {
+	return fm.ViewAllWith(ViewOptions{})
+}
+
+// ViewWith is like View with customized output.
+func (fm *StateMachine) ViewWith(opts ViewOptions) (graphViz, flowChart, diagram string) {
+	set := fm.ViewAllWith(opts)
+	return set.Graphviz, set.MermaidFlowchart, set.MermaidState
+}
+
+// ViewAllWith is like ViewAll with customized output.
+func (fm *StateMachine) ViewAllWith(opts ViewOptions) DiagramSet {
+	fm.mutex.RLock()
+	defer fm.mutex.RUnlock()
+
+	highlighted := func(state string) bool {
+		return !opts.DisableHighlight && state == string(fm.current)
+	}
+
+	var getSortedStates = func() ([]string, map[string]string) {
+		states := fm.sortedStates(true)
+		ids := stateIDs("id", states, opts.StableIDs)
+
+		sortedStates := make([]string, 0, len(states))
+		statesToIDMap := make(map[string]string, len(states))
+		for _, state := range states {
+			sortedStates = append(sortedStates, string(state))
+			statesToIDMap[string(state)] = ids[state]
+		}
+		return sortedStates, statesToIDMap
+	}
+
+	edges := fm.edges()
+	sortedStates, statesToIDMap := getSortedStates()
+
+	var bufFlowChart strings.Builder
+	{
+		// writeFlowChartGraphType
+		bufFlowChart.WriteString("graph LR\n")
+
+		// writeFlowChartStates
+		for _, state := range sortedStates {
+			if State(state) == AnyState {
+				bufFlowChart.WriteString(fmt.Sprintf(`    %s((any state))`, statesToIDMap[state]))
+			} else {
+				bufFlowChart.WriteString(fmt.Sprintf(`    %s[%s]`, statesToIDMap[state], mermaidText(state)))
+			}
+			bufFlowChart.WriteString("\n")
+		}
+
+		// writeFlowChartSubgraphs
+		subgraphs := 0
+		fm.writeHierarchy(&bufFlowChart, "    ", func(parent State) string {
+			subgraphs++
+			return fmt.Sprintf("subgraph sg%d [%s]", subgraphs-1, mermaidText(string(parent)))
+		}, func(child State) string {
+			return statesToIDMap[string(child)]
+		}, "end")
+		bufFlowChart.WriteString("\n")
+
+		// writeFlowChartTransitions
+		for _, transition := range edges {
+			arrow := "-->"
+			if transition.From == AnyState || fm.disabled[eKey{transition.From, transition.Event}] {
+				arrow = "-.->"
+			}
+			bufFlowChart.WriteString(fmt.Sprintf(`    %s %s |%s| %s`, statesToIDMap[string(transition.From)], arrow, mermaidText(string(transition.Event)), statesToIDMap[string(transition.To)]))
+			bufFlowChart.WriteString("\n")
+		}
+		bufFlowChart.WriteString("\n")
+
+		// writeFlowChartStateColors
+		for _, state := range sortedStates {
+			if color, ok := fm.stateColors[State(state)]; ok && !highlighted(state) {
+				bufFlowChart.WriteString(fmt.Sprintf(`    style %s fill:%s`, statesToIDMap[state], color))
+				bufFlowChart.WriteString("\n")
+			}
+		}
+
+		// writeFlowChartHighlightCurrent
+		const highlightingColor = "#00AA00"
+		if !opts.DisableHighlight {
+			id := statesToIDMap[string(fm.current)]
+			if color, ok := fm.stateColors[fm.current]; ok && opts.CurrentFill == "" {
+				stroke := highlightingColor
+				if opts.CurrentStroke != "" {
+					stroke = opts.CurrentStroke
+				}
+				bufFlowChart.WriteString(fmt.Sprintf(`    style %s fill:%s,stroke:%s,stroke-width:4px`, id, color, stroke))
+			} else {
+				fill := highlightingColor
+				if opts.CurrentFill != "" {
+					fill = opts.CurrentFill
+				}
+				bufFlowChart.WriteString(fmt.Sprintf(`    style %s fill:%s`, id, fill))
+				if opts.CurrentStroke != "" {
+					bufFlowChart.WriteString(fmt.Sprintf(`,stroke:%s`, opts.CurrentStroke))
+				}
+			}
+			bufFlowChart.WriteString("\n")
+		}
+
+		// writeFlowChartLegend
+		if opts.Legend {
+			colors, colored := fm.colorGroups()
+			bufFlowChart.WriteString("\n    subgraph legend [Legend]\n")
+			if !opts.DisableHighlight {
+				bufFlowChart.WriteString("        legend_current[current state]\n")
+			}
+			for i, color := range colors {
+				bufFlowChart.WriteString(fmt.Sprintf("        legend_color%d[%s]\n", i, mermaidText(colored[color])))
+			}
+			bufFlowChart.WriteString("    end\n")
+			if !opts.DisableHighlight {
+				fill := highlightingColor
+				if opts.CurrentFill != "" {
+					fill = opts.CurrentFill
+				}
+				bufFlowChart.WriteString(fmt.Sprintf(`    style legend_current fill:%s`, fill))
+				if opts.CurrentStroke != "" {
+					bufFlowChart.WriteString(fmt.Sprintf(`,stroke:%s`, opts.CurrentStroke))
+				}
+				bufFlowChart.WriteString("\n")
+			}
+			for i, color := range colors {
+				bufFlowChart.WriteString(fmt.Sprintf("    style legend_color%d fill:%s\n", i, color))
+			}
+		}
+	}
+
+	var bufGraphViz strings.Builder
+	{
+		// writeHeaderLine
+		bufGraphViz.WriteString(`digraph fsm {`)
+		bufGraphViz.WriteString("\n")
+
+		// writeTransitions
+		maxWeight := 0
+		for _, weight := range opts.EdgeWeights {
+			if weight > maxWeight {
+				maxWeight = weight
+			}
+		}
+		for _, v := range edges {
+			attrs := fmt.Sprintf(`label = "%s"`, dotText(string(v.Event)))
+			if weight, ok := opts.EdgeWeights[TransitionKey{v.From, v.Event}]; ok {
+				attrs = fmt.Sprintf(`label = "%s (%d)", penwidth = %.1f`, dotText(string(v.Event)), weight, penWidth(weight, maxWeight))
+			}
+			if v.From == AnyState || fm.disabled[eKey{v.From, v.Event}] {
+				attrs += `, style = "dashed"`
+			}
+			var tooltip []string
+			if description, ok := v.Meta["description"]; ok {
+				tooltip = append(tooltip, description)
+			}
+			if aliases := fm.aliasesOf(v.Event); len(aliases) > 0 {
+				names := make([]string, 0, len(aliases))
+				for _, alias := range aliases {
+					names = append(names, string(alias))
+				}
+				tooltip = append(tooltip, "aliases: "+strings.Join(names, ", "))
+			}
+			if len(tooltip) > 0 {
+				attrs += fmt.Sprintf(`, tooltip = "%s"`, dotText(strings.Join(tooltip, "; ")))
+			}
+			bufGraphViz.WriteString(fmt.Sprintf(`    "%s" -> "%s" [ %s ];`, dotText(string(v.From)), dotText(string(v.To)), attrs))
+			bufGraphViz.WriteString("\n")
+		}
+
+		bufGraphViz.WriteString("\n")
+
+		// writeStates
+		stroke := "red"
+		if opts.CurrentStroke != "" {
+			stroke = opts.CurrentStroke
+		}
+		for _, state := range sortedStates {
+			k := dotText(state)
+			color, colored := fm.stateColors[State(state)]
+			if highlighted(state) && opts.CurrentFill != "" {
+				color, colored = opts.CurrentFill, true
+			}
+			if highlighted(state) && colored {
+				bufGraphViz.WriteString(fmt.Sprintf(`    "%s" [color = "%s", style = "filled,bold", fillcolor = "%s"];`, k, stroke, color))
+			} else if highlighted(state) {
+				bufGraphViz.WriteString(fmt.Sprintf(`    "%s" [color = "%s"];`, k, stroke))
+			} else if colored {
+				bufGraphViz.WriteString(fmt.Sprintf(`    "%s" [style = "filled", fillcolor = "%s"];`, k, color))
+			} else if State(state) == AnyState {
+				bufGraphViz.WriteString(fmt.Sprintf(`    "%s" [label = "any state", style = "dashed"];`, k))
+			} else {
+				bufGraphViz.WriteString(fmt.Sprintf(`    "%s";`, k))
+			}
+			bufGraphViz.WriteString("\n")
+		}
+
+		// writeRanks
+		if opts.RankByDepth {
+			fm.writeRanks(&bufGraphViz)
+		}
+
+		// writeClusters
+		fm.writeHierarchy(&bufGraphViz, "    ", func(parent State) string {
+			return fmt.Sprintf(`subgraph "cluster_%s" { label = "%s";`, dotText(string(parent)), dotText(string(parent)))
+		}, func(child State) string {
+			return fmt.Sprintf(`"%s";`, dotText(string(child)))
+		}, "}")
+
+		// writeLegend
+		if opts.Legend {
+			colors, colored := fm.colorGroups()
+			bufGraphViz.WriteString("    subgraph \"cluster_legend\" { label = \"Legend\";\n")
+			if !opts.DisableHighlight {
+				if opts.CurrentFill != "" {
+					bufGraphViz.WriteString(fmt.Sprintf(`        "legend_current" [label = "current state", color = "%s", style = "filled,bold", fillcolor = "%s"];`, stroke, opts.CurrentFill))
+				} else {
+					bufGraphViz.WriteString(fmt.Sprintf(`        "legend_current" [label = "current state", color = "%s"];`, stroke))
+				}
+				bufGraphViz.WriteString("\n")
+			}
+			for i, color := range colors {
+				bufGraphViz.WriteString(fmt.Sprintf(`        "legend_color%d" [label = "%s", style = "filled", fillcolor = "%s"];`, i, dotText(colored[color]), color))
+				bufGraphViz.WriteString("\n")
+			}
+			bufGraphViz.WriteString("    }\n")
+		}
+
+		// writeFooter
+		bufGraphViz.WriteString(fmt.Sprintln("}"))
+	}
+
+	return DiagramSet{
+		Graphviz:         bufGraphViz.String(),
+		MermaidFlowchart: bufFlowChart.String(),
+		MermaidState:     fm.stateDiagram(false, opts.StableIDs),
+		PlantUML:         fm.plantUML(opts.StableIDs),
+	}
+}
+
+// ViewStateDiagramV2 returns a Mermaid stateDiagram-v2. Guarded edges are
+// annotated with the transition's GuardLabel, e.g. "Ship [hasStock]".
+func (fm *StateMachine) ViewStateDiagramV2() string {
+	fm.mutex.RLock()
+	defer fm.mutex.RUnlock()
+
+	return fm.stateDiagram(true, false)
+}
+
+// stateDiagram writes the Mermaid stateDiagram returned by View, or the
+// stateDiagram-v2 variant with guard annotations.
+func (fm *StateMachine) stateDiagram(v2, stable bool) string {
+	var (
+		bufDiagram strings.Builder
+		states     = fm.sortedStates(true)
+		aliases    = diagramAliases(states, stable)
+	)
+
+	if v2 {
+		bufDiagram.WriteString("stateDiagram-v2\n")
+	} else {
+		bufDiagram.WriteString("stateDiagram\n")
+	}
+	bufDiagram.WriteString(fmt.Sprintln(`    [*] -->`, diagramName(aliases, fm.initial)))
+	for _, state := range states {
+		if alias, ok := aliases[state]; ok {
+			bufDiagram.WriteString(fmt.Sprintf(`    state "%s" as %s`, mermaidEscaper.Replace(diagramLabel(state)), alias))
+			bufDiagram.WriteString("\n")
+		}
+	}
+	fm.writeHierarchy(&bufDiagram, "    ", func(parent State) string {
+		return fmt.Sprintf("state %s {", diagramName(aliases, parent))
+	}, func(child State) string {
+		return diagramName(aliases, child)
+	}, "}")
+
+	for _, v := range fm.edges() {
+		label := string(v.Event)
+		if v2 && v.Guard != nil {
+			label += fmt.Sprintf(" [%s]", v.guardLabel())
+		}
+		bufDiagram.WriteString(fmt.Sprintf(`    %s --> %s: %s`, diagramName(aliases, v.From), diagramName(aliases, v.To), mermaidEscaper.Replace(label)))
+		bufDiagram.WriteString("\n")
+	}
+
+	return bufDiagram.String()
+}
+
+// ViewTable returns the transitions as a plain-text table with aligned
+// "From | Event | To" columns, in the same order as Transitions. Rows leaving
+// the current state are marked with an asterisk.
+func (fm *StateMachine) ViewTable() string {
+	fm.mutex.RLock()
+	defer fm.mutex.RUnlock()
+
+	var buf strings.Builder
+
+	w := tabwriter.NewWriter(&buf, 0, 0, 1, ' ', 0)
+	fmt.Fprintln(w, "  From\t| Event\t| To")
+	for _, v := range fm.edges() {
+		mark := " "
+		if v.From == fm.current {
+			mark = "*"
+		}
+		fmt.Fprintf(w, "%s %s\t| %s\t| %s\n", mark, v.From, v.Event, v.To)
+	}
+	w.Flush()
+
+	return buf.String()
+}
+
+// ViewPlantUML
+// https://www.plantuml.com/plantuml
+func (fm *StateMachine) ViewPlantUML() string {
+	fm.mutex.RLock()
+	defer fm.mutex.RUnlock()
+
+	return fm.plantUML(false)
+}
+
+func (fm *StateMachine) plantUML(stable bool) string {
+	var buf strings.Builder
+
+	states := fm.sortedStates(true)
+	aliases := diagramAliases(states, stable)
+
+	buf.WriteString("@startuml\n")
+	buf.WriteString(fmt.Sprintf("[*] --> %s\n", diagramName(aliases, fm.initial)))
+
+	for _, state := range states {
+		if alias, ok := aliases[state]; ok {
+			buf.WriteString(fmt.Sprintf("state \"%s\" as %s\n", plantUMLEscaper.Replace(diagramLabel(state)), alias))
+		}
+	}
+	fm.writeHierarchy(&buf, "", func(parent State) string {
+		return fmt.Sprintf("state %s {", diagramName(aliases, parent))
+	}, func(child State) string {
+		return "state " + diagramName(aliases, child)
+	}, "}")
+
+	for _, v := range fm.edges() {
+		buf.WriteString(fmt.Sprintf("%s --> %s : %s\n", diagramName(aliases, v.From), diagramName(aliases, v.To), plantUMLEscaper.Replace(string(v.Event))))
+	}
+
+	// highlight current
+	buf.WriteString(fmt.Sprintf("state %s #00AA00\n", diagramName(aliases, fm.current)))
+	buf.WriteString("@enduml\n")
+
+	return buf.String()
+}
@@ -0,0 +1,90 @@
+package fsm
+
+import (
+	"strings"
+	"testing"
+)
+
+func adversarialMachine(t *testing.T) *StateMachine {
+	t.Helper()
+
+	fm := NewStateMachine(`say "hi"`)
+	if err := fm.AddTransitions(
+		&Transition{From: `say "hi"`, Event: `a|b[c]`, To: `back\slash`},
+		&Transition{From: `back\slash`, Event: `下一步：「确认」`, To: `[x]{y}`},
+	); err != nil {
+		t.Fatal(err)
+	}
+	return fm
+}
+
+// unbalancedQuote reports whether line has an odd number of unescaped
+// double quotes.
+func unbalancedQuote(line string) bool {
+	quotes := 0
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '"':
+			quotes++
+		}
+	}
+	return quotes%2 != 0
+}
+
+func TestViewEscapesGraphviz(t *testing.T) {
+	graphViz, _, _ := adversarialMachine(t).View()
+
+	for _, want := range []string{
+		`"say \"hi\"" -> "back\\slash" [ label = "a|b[c]" ];`,
+		`"back\\slash" -> "[x]{y}" [ label = "下一步：「确认」" ];`,
+	} {
+		if !strings.Contains(graphViz, want) {
+			t.Errorf("Graphviz output lacks %s:\n%s", want, graphViz)
+		}
+	}
+	for _, line := range strings.Split(graphViz, "\n") {
+		if unbalancedQuote(line) {
+			t.Errorf("unbalanced quotes in %q", line)
+		}
+	}
+}
+
+func TestViewEscapesMermaid(t *testing.T) {
+	_, flowChart, diagram := adversarialMachine(t).View()
+
+	for _, want := range []string{
+		`id0["[x]{y}"]`,
+		`id1[back\slash]`,
+		`id2["say #quot;hi#quot;"]`,
+		`id2 --> |"a|b[c]"| id1`,
+		`id1 --> |下一步：「确认」| id0`,
+	} {
+		if !strings.Contains(flowChart, want) {
+			t.Errorf("flowchart lacks %s:\n%s", want, flowChart)
+		}
+	}
+	for _, want := range []string{
+		`state "[x]{y}" as s0`,
+		`state "say #quot;hi#quot;" as s2`,
+		`s2 --> s1: a|b[c]`,
+	} {
+		if !strings.Contains(diagram, want) {
+			t.Errorf("state diagram lacks %s:\n%s", want, diagram)
+		}
+	}
+}
+
+func TestViewEscapesPlantUML(t *testing.T) {
+	uml := adversarialMachine(t).ViewPlantUML()
+
+	if !strings.Contains(uml, `state "say <U+0022>hi<U+0022>" as s2`) {
+		t.Errorf("PlantUML output does not escape quotes:\n%s", uml)
+	}
+	for _, line := range strings.Split(uml, "\n") {
+		if unbalancedQuote(line) {
+			t.Errorf("unbalanced quotes in %q", line)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package fsm
+
+import "context"
+
+type waiter struct {
+	target State
+	done   chan error
+}
+
+// WaitForState blocks until the machine is in target, returning nil at once
+// if it already is. It returns ctx.Err() if ctx is done first and ErrClosed
+// if the machine is closed while waiting.
+func (fm *StateMachine) WaitForState(ctx context.Context, target State) error {
+	fm.mutex.Lock()
+	if fm.current == target {
+		fm.mutex.Unlock()
+		return nil
+	}
+	if fm.closed {
+		fm.mutex.Unlock()
+		return ErrClosed
+	}
+	w := &waiter{target: target, done: make(chan error, 1)}
+	fm.waiters = append(fm.waiters, w)
+	fm.mutex.Unlock()
+
+	select {
+	case err := <-w.done:
+		return err
+	case <-ctx.Done():
+		fm.mutex.Lock()
+		defer fm.mutex.Unlock()
+
+		for i, v := range fm.waiters {
+			if v == w {
+				fm.waiters = append(fm.waiters[:i:i], fm.waiters[i+1:]...)
+				break
+			}
+		}
+		return ctx.Err()
+	}
+}
+
+// wakeWaiters releases the waiters for state. The caller must hold the
+// write lock.
+func (fm *StateMachine) wakeWaiters(state State) {
+	waiters := fm.waiters[:0]
+	for _, w := range fm.waiters {
+		if w.target == state {
+			w.done <- nil
+		} else {
+			waiters = append(waiters, w)
+		}
+	}
+	fm.waiters = waiters
+}
+
+// wakeAll releases every waiter with err. The caller must hold the write
+// lock.
+func (fm *StateMachine) wakeAll(err error) {
+	for _, w := range fm.waiters {
+		w.done <- err
+	}
+	fm.waiters = nil
+}
@@ -0,0 +1,45 @@
+package fsm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSetCurrentEmptyWakesNoWaiter(t *testing.T) {
+	fm := NewStateMachine("A")
+	if err := fm.AddTransitions(&Transition{From: "A", Event: "go", To: "B"}); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*tick)
+		defer cancel()
+		done <- fm.WaitForState(ctx, "C")
+	}()
+	time.Sleep(tick)
+
+	if err := fm.UnmarshalJSON([]byte(`{"transitions":[]}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("WaitForState(C) = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestWaitForStateClosed(t *testing.T) {
+	fm := NewStateMachine("A")
+
+	done := make(chan error, 1)
+	go func() { done <- fm.WaitForState(context.Background(), "B") }()
+	time.Sleep(tick)
+
+	if err := fm.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; !errors.Is(err, ErrClosed) {
+		t.Errorf("WaitForState(B) = %v, want ErrClosed", err)
+	}
+}
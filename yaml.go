@@ -0,0 +1,277 @@
+package fsm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type yamlTransition struct {
+	line   int
+	fields map[string]string
+}
+
+// LoadYAML builds a machine from a YAML document such as:
+//
+//	initial: pending
+//	transitions:
+//	  - from: pending
+//	    event: pay
+//	    to: paid
+//	    description: payment received
+//	  - {from: paid, event: ship, to: shipped}
+//
+// Only this shape is understood: plain, single- or double-quoted scalars,
+// block or flow mappings for the entries and '#' comments. The initial state
+// defaults to the From of the first transition. Transitions get a no-op
+// handler and their description, if any, is stored as Meta["description"].
+// Errors name the line and the YAML path of the offending value.
+func LoadYAML(r io.Reader) (*StateMachine, error) {
+	var (
+		initial     State
+		items       []*yamlTransition
+		inList      bool
+		item        *yamlTransition
+		itemIndent  int
+		keyIndent   int
+		scanner     = bufio.NewScanner(r)
+		lineNo      = 0
+		currentPath = func() string { return fmt.Sprintf("transitions[%d]", len(items)-1) }
+	)
+
+	for scanner.Scan() {
+		lineNo++
+
+		raw := stripYAMLComment(scanner.Text())
+		if strings.TrimSpace(raw) == "" || strings.TrimRight(raw, " \t") == "---" {
+			continue
+		}
+		body := strings.TrimLeft(raw, " ")
+		indent := len(raw) - len(body)
+		if strings.HasPrefix(body, "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed for indentation", lineNo)
+		}
+		body = strings.TrimRight(body, " \t")
+
+		switch {
+		case inList && strings.HasPrefix(body+" ", "- "):
+			item = &yamlTransition{line: lineNo, fields: make(map[string]string)}
+			items = append(items, item)
+			itemIndent = indent
+
+			rest := strings.TrimSpace(body[1:])
+			keyIndent = -1
+			if rest != "" {
+				keyIndent = indent + len(body) - len(rest)
+			}
+			if strings.HasPrefix(rest, "{") {
+				if err := parseYAMLFlow(rest, item.fields); err != nil {
+					return nil, fmt.Errorf("line %d: %s: %w", lineNo, currentPath(), err)
+				}
+				item = nil
+				continue
+			}
+			if rest == "" {
+				continue
+			}
+			body = rest
+		case item != nil && indent > itemIndent:
+			// another key of the current entry, aligned with the first
+			if keyIndent < 0 {
+				keyIndent = indent
+			}
+			if indent != keyIndent {
+				return nil, fmt.Errorf("line %d: %s: unexpected indentation", lineNo, currentPath())
+			}
+		case indent == 0:
+			inList, item = false, nil
+		default:
+			return nil, fmt.Errorf("line %d: unexpected indentation", lineNo)
+		}
+
+		key, value, err := splitYAMLPair(body)
+		if err != nil {
+			if item != nil {
+				return nil, fmt.Errorf("line %d: %s: %w", lineNo, currentPath(), err)
+			}
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+
+		if item != nil {
+			if err := setYAMLField(item.fields, key, value); err != nil {
+				return nil, fmt.Errorf("line %d: %s.%w", lineNo, currentPath(), err)
+			}
+			continue
+		}
+
+		switch key {
+		case "initial":
+			initial = State(value)
+		case "transitions":
+			if value != "" && value != "[]" {
+				return nil, fmt.Errorf("line %d: transitions: expected a list", lineNo)
+			}
+			inList = value == ""
+		default:
+			return nil, fmt.Errorf("line %d: %s: unknown key", lineNo, key)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, ErrNoTransitionsDefined
+	}
+
+	transitions := make([]*Transition, 0, len(items))
+	for i, item := range items {
+		for _, key := range []string{"from", "event", "to"} {
+			if item.fields[key] == "" {
+				return nil, fmt.Errorf("line %d: transitions[%d].%s: missing or empty", item.line, i, key)
+			}
+		}
+
+		trans := &Transition{
+			From:   State(item.fields["from"]),
+			Event:  Event(item.fields["event"]),
+			To:     State(item.fields["to"]),
+			Handle: noopHandler,
+		}
+		if description, ok := item.fields["description"]; ok {
+			trans.Meta = map[string]string{"description": description}
+		}
+		transitions = append(transitions, trans)
+	}
+
+	if initial == "" {
+		initial = transitions[0].From
+	}
+	fm := NewStateMachine(initial)
+	for i, trans := range transitions {
+		if err := fm.AddTransitions(trans); err != nil {
+			return nil, fmt.Errorf("line %d: transitions[%d]: %w", items[i].line, i, err)
+		}
+	}
+
+	return fm, nil
+}
+
+// stripYAMLComment removes a '#' comment that is not inside quotes.
+func stripYAMLComment(line string) string {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+
+	return line
+}
+
+// splitYAMLPair splits "key: value" and unquotes the value.
+func splitYAMLPair(s string) (key, value string, err error) {
+	i := strings.Index(s+" ", ": ")
+	if i < 0 {
+		return "", "", fmt.Errorf("expected key: value, got %q", s)
+	}
+
+	key = strings.TrimSpace(s[:i])
+	if key == "" {
+		return "", "", fmt.Errorf("empty key in %q", s)
+	}
+	value, err = parseYAMLScalar(s[i+1:])
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", key, err)
+	}
+
+	return key, value, nil
+}
+
+// parseYAMLFlow parses a flow mapping such as "{from: a, event: b, to: c}"
+// into fields.
+func parseYAMLFlow(s string, fields map[string]string) error {
+	if !strings.HasSuffix(s, "}") {
+		return fmt.Errorf("unterminated flow mapping %q", s)
+	}
+
+	var (
+		inner = s[1 : len(s)-1]
+		quote rune
+		start = 0
+		parts []string
+	)
+	for i, r := range inner {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == ',':
+			parts = append(parts, inner[start:i])
+			start = i + 1
+		}
+	}
+	parts = append(parts, inner[start:])
+
+	for _, part := range parts {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		key, value, err := splitYAMLPair(strings.TrimSpace(part))
+		if err != nil {
+			return err
+		}
+		if err := setYAMLField(fields, key, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setYAMLField stores the value of a transition entry key.
+func setYAMLField(fields map[string]string, key, value string) error {
+	switch key {
+	case "from", "event", "to", "description":
+	default:
+		return fmt.Errorf("%s: unknown key", key)
+	}
+	if _, ok := fields[key]; ok {
+		return fmt.Errorf("%s: duplicate key", key)
+	}
+
+	fields[key] = value
+	return nil
+}
+
+// parseYAMLScalar returns the value of a plain, single- or double-quoted
+// scalar.
+func parseYAMLScalar(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case strings.HasPrefix(s, `"`):
+		value, err := strconv.Unquote(s)
+		if err != nil {
+			return "", fmt.Errorf("invalid double-quoted string %s", s)
+		}
+		return value, nil
+	case strings.HasPrefix(s, "'"):
+		if len(s) < 2 || !strings.HasSuffix(s, "'") {
+			return "", fmt.Errorf("invalid single-quoted string %s", s)
+		}
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	}
+
+	return s, nil
+}
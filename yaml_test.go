@@ -0,0 +1,113 @@
+package fsm
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLoadYAML(t *testing.T) {
+	tests := []struct {
+		name        string
+		doc         string
+		initial     State
+		transitions []Transition
+	}{
+		{
+			name: "block and flow entries",
+			doc: `initial: pending
+transitions:
+  - from: pending
+    event: pay
+    to: paid
+    description: payment received
+  - {from: paid, event: ship, to: shipped}
+`,
+			initial: "pending",
+			transitions: []Transition{
+				{From: "paid", Event: "ship", To: "shipped"},
+				{From: "pending", Event: "pay", To: "paid", Meta: map[string]string{"description": "payment received"}},
+			},
+		},
+		{
+			name: "quotes, comments and a default initial state",
+			doc: `--- 
+# an order
+transitions:   # the list
+-
+  from: "a # b"
+  event: 'it''s'
+  to: "c\td"
+- {from: 'x, y', event: "go", to: z}
+`,
+			initial: "a # b",
+			transitions: []Transition{
+				{From: "a # b", Event: "it's", To: "c\td"},
+				{From: "x, y", Event: "go", To: "z"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fm, err := LoadYAML(strings.NewReader(test.doc))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fm.InitialState(); got != test.initial {
+				t.Errorf("initial = %q, want %q", got, test.initial)
+			}
+			got := fm.Transitions()
+			if len(got) != len(test.transitions) {
+				t.Fatalf("got %d transitions, want %d", len(got), len(test.transitions))
+			}
+			for i, want := range test.transitions {
+				if got[i].From != want.From || got[i].Event != want.Event || got[i].To != want.To ||
+					got[i].Meta["description"] != want.Meta["description"] {
+					t.Errorf("transition %d = %+v, want %+v", i, got[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadYAMLErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		err  string
+	}{
+		{"empty", "# nothing\n", ErrNoTransitionsDefined.Error()},
+		{"unknown top-level key", "initial: a\nstates: []\n", "line 2: states: unknown key"},
+		{"transitions not a list", "transitions: a\n", "line 1: transitions: expected a list"},
+		{"tab indentation", "transitions:\n\t- from: a\n", "line 2: tabs are not allowed for indentation"},
+		{"misaligned key", "transitions:\n  - from: a\n    event: go\n   to: b\n", "line 4: transitions[0]: unexpected indentation"},
+		{"misaligned key after dash", "transitions:\n  -\n    from: a\n      event: go\n", "line 4: transitions[0]: unexpected indentation"},
+		{"stray indentation", "initial: a\n  transitions:\n", "line 2: unexpected indentation"},
+		{"unknown entry key", "transitions:\n  - from: a\n    on: go\n", "line 3: transitions[0].on: unknown key"},
+		{"duplicate entry key", "transitions:\n  - from: a\n    from: b\n", "line 3: transitions[0].from: duplicate key"},
+		{"not a pair", "transitions:\n  - from a\n", `line 2: transitions[0]: expected key: value, got "from a"`},
+		{"bad double quotes", "transitions:\n  - from: \"a\n", "line 2: transitions[0]: from: invalid double-quoted string"},
+		{"bad single quotes", "initial: 'a\n", "line 1: initial: invalid single-quoted string"},
+		{"unterminated flow", "transitions:\n  - {from: a, event: go\n", "line 2: transitions[0]: unterminated flow mapping"},
+		{"unknown flow key", "transitions:\n  - {from: a, on: go}\n", "line 2: transitions[0]: on: unknown key"},
+		{"missing field", "transitions:\n  - from: a\n    event: go\n  - {from: b, event: go, to: c}\n", "line 2: transitions[0].to: missing or empty"},
+		{"duplicate transition", "transitions:\n  - {from: a, event: go, to: b}\n  - {from: a, event: go, to: c}\n", "line 3: transitions[1]: state, event: [a, go] existed"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := LoadYAML(strings.NewReader(test.doc))
+			if err == nil {
+				t.Fatal("LoadYAML succeeded")
+			}
+			if !strings.Contains(err.Error(), test.err) {
+				t.Errorf("error = %q, want it to contain %q", err, test.err)
+			}
+		})
+	}
+
+	if _, err := LoadYAML(strings.NewReader("")); !errors.Is(err, ErrNoTransitionsDefined) {
+		t.Errorf("empty document: %v, want ErrNoTransitionsDefined", err)
+	}
+}